@@ -0,0 +1,249 @@
+package auth
+
+// imports
+import (
+	"crypto/ed25519";
+	"crypto/rsa";
+	"crypto/x509";
+	"encoding/base64";
+	"encoding/pem";
+	"errors";
+	"fmt";
+	"math/big";
+	"os";
+	"path/filepath";
+	"sort";
+	"strings";
+	"github.com/golang-jwt/jwt/v5";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
+)
+
+// id of the key built from the shared hmac secret
+const secretKeyID = "secret"
+
+var (
+	errUnknownKey         = errors.New("token signed with an unknown key")
+	errAlgorithmMismatch  = errors.New("token algorithm doesn't match its key")
+)
+
+// one signing/verification key
+type Key struct {
+	ID           string                 // key id, sent as "kid" in token headers
+	Method       jwt.SigningMethod      // HS256, RS256 or EdDSA
+	signKey      interface{}            // secret or private key, nil for verify-only keys
+	verifyKey    interface{}            // secret or public key
+}
+
+// every key tokens may be verified with, and the one new tokens are signed with.
+// keeping retired keys around lets tokens signed before a rotation stay valid until they expire
+type KeySet struct {
+	keys         map[string]*Key        // keys by id
+	active       *Key                   // key used for signing
+}
+
+// public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty          string      `json:"kty"`                // key type (RSA or OKP)
+	Kid          string      `json:"kid"`                // key id
+	Use          string      `json:"use"`                // always "sig"
+	Alg          string      `json:"alg"`                // RS256 or EdDSA
+	N            string      `json:"n,omitempty"`        // rsa modulus
+	E            string      `json:"e,omitempty"`        // rsa exponent
+	Crv          string      `json:"crv,omitempty"`      // ed25519 curve name
+	X            string      `json:"x,omitempty"`        // ed25519 public key
+}
+
+// JSON Web Key Set served at /.well-known/jwks.json
+type JWKS struct {
+	Keys         []JWK       `json:"keys"`
+}
+
+// build the key set described by the jwt configuration.
+// with only a secret, tokens are signed with HS256. with a keys directory, every *.pem file in it
+// is a key named after the file, the active one signs new tokens and the rest only verify.
+// if a secret is configured next to a keys directory it is kept for verification only,
+// so HS256 tokens issued before switching keep working until they expire
+func LoadKeySet(jwtConfig config.JWTConfig) (*KeySet, error) {
+
+	keys := &KeySet{keys: map[string]*Key{}}
+
+	if jwtConfig.Secret != "" {
+		secret := []byte(jwtConfig.Secret)
+		keys.keys[secretKeyID] = &Key{
+			ID:        secretKeyID,
+			Method:    jwt.SigningMethodHS256,
+			signKey:   secret,
+			verifyKey: secret,
+		}
+	}
+
+	if jwtConfig.KeysDir == "" {
+		keys.active = keys.keys[secretKeyID]
+		if keys.active == nil {
+			return nil, errors.New("no signing keys configured")
+		}
+		return keys, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(jwtConfig.KeysDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		key, err := loadPEMKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %v", path, err)
+		}
+		keys.keys[key.ID] = key
+	}
+
+	active, exists := keys.keys[jwtConfig.ActiveKeyID]
+	if !exists || active.ID == secretKeyID {
+		return nil, fmt.Errorf("active signing key %q not found in %s", jwtConfig.ActiveKeyID, jwtConfig.KeysDir)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("active signing key %q is a public key, a private key is needed to sign", active.ID)
+	}
+
+	keys.active = active
+	return keys, nil
+}
+
+// parse a pem encoded private or public rsa/ed25519 key, the file name (without .pem) is the key id
+func loadPEMKey(path string) (*Key, error) {
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no pem data found")
+	}
+
+	key := &Key{ID: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported pem block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch typed := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, typed, &typed.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.verifyKey = jwt.SigningMethodRS256, typed
+	case ed25519.PrivateKey:
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, typed, typed.Public().(ed25519.PublicKey)
+	case ed25519.PublicKey:
+		key.Method, key.verifyKey = jwt.SigningMethodEdDSA, typed
+	default:
+		return nil, fmt.Errorf("unsupported key type %T (use RSA or Ed25519)", parsed)
+	}
+
+	rsaKey, ok := key.verifyKey.(*rsa.PublicKey)
+	if ok && rsaKey.N.BitLen() < 2048 {
+		return nil, errors.New("rsa keys must be at least 2048 bits")
+	}
+
+	return key, nil
+}
+
+// id of the key new tokens are signed with
+func (keys *KeySet) ActiveKeyID() string {
+	return keys.active.ID
+}
+
+// sign claims with the active key, recording its id in the "kid" header
+func (keys *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(keys.active.Method, claims)
+	token.Header["kid"] = keys.active.ID
+	return token.SignedString(keys.active.signKey)
+}
+
+// sign and verify a throwaway token, so a broken active key shows up in readiness checks
+func (keys *KeySet) Check() error {
+
+	signed, err := keys.sign(jwt.MapClaims{"sub": "health-check"})
+	if err != nil {
+		return fmt.Errorf("active key %q can not sign: %v", keys.active.ID, err)
+	}
+
+	_, err = jwt.Parse(signed, keys.keyfunc)
+	if err != nil {
+		return fmt.Errorf("active key %q can not verify its own tokens: %v", keys.active.ID, err)
+	}
+
+	return nil
+}
+
+// jwt.Keyfunc that picks the verification key by "kid" and refuses any token whose
+// algorithm doesn't match that key, so e.g. an rsa public key can't be used as an hmac secret
+func (keys *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+
+	kid, _ := token.Header["kid"].(string)
+
+	var key *Key
+	if kid == "" {
+		// tokens issued before key ids were introduced were signed with the secret
+		key = keys.keys[secretKeyID]
+	} else {
+		key = keys.keys[kid]
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("%w %q", errUnknownKey, kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errAlgorithmMismatch      // block algorithm confusion
+	}
+
+	return key.verifyKey, nil
+}
+
+// public keys for other services to verify our tokens, hmac secrets are never published
+func (keys *KeySet) JWKS() JWKS {
+
+	jwks := JWKS{Keys: []JWK{}}
+
+	ids := make([]string, 0, len(keys.keys))
+	for id := range keys.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := keys.keys[id]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue      // symmetric key
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
@@ -0,0 +1,107 @@
+package auth
+
+// imports
+import (
+	"crypto/rand";
+	"encoding/base64";
+	"errors";
+	"time";
+	"github.com/golang-jwt/jwt/v5";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
+)
+
+var errMissingIdentity = errors.New("token has no subject or id")
+
+// claims of an access token, written by NewAccessToken and read back by the Verifier
+type Claims struct {
+	jwt.RegisteredClaims                   // sub (user id), iss, aud, iat, nbf, exp and jti (token id)
+	Username     string       `json:"username"`             // username
+	Role         string       `json:"role"`                 // user role (admin/user)
+}
+
+// sign a new access token for a user with the active key
+func NewAccessToken(keys *KeySet, jwtConfig config.JWTConfig, userID, username, role string) (string, error) {
+
+	// unique token id, so a single token can be revoked on logout
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Issuer:    jwtConfig.Issuer,
+			Audience:  jwt.ClaimStrings{jwtConfig.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),      // checked against user-wide revocations
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(jwtConfig.AccessTokenTTL)),      // short-lived, renewed through /token/refresh
+			ID:        base64.RawURLEncoding.EncodeToString(buf),
+		},
+		Username: username,
+		Role:     role,
+	}
+
+	// its id goes in the "kid" header
+	return keys.sign(claims)
+}
+
+// checks signature, issuer, audience and validity period of access tokens
+type Verifier struct {
+	keys         *KeySet            // keys tokens may be signed with
+	parser       *jwt.Parser        // configured issuer, audience and clock skew
+}
+
+func NewVerifier(keys *KeySet, jwtConfig config.JWTConfig) *Verifier {
+	return &Verifier{
+		keys: keys,
+		parser: jwt.NewParser(
+			jwt.WithIssuer(jwtConfig.Issuer),
+			jwt.WithAudience(jwtConfig.Audience),
+			jwt.WithLeeway(jwtConfig.ClockSkew),      // applies to exp, nbf and iat
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+		),
+	}
+}
+
+// verify token and return its claims, FailureReason says what was wrong with a rejected one
+func (verifier *Verifier) Verify(token string) (*Claims, error) {
+
+	claims := &Claims{}
+	_, err := verifier.parser.ParseWithClaims(token, claims, verifier.keys.keyfunc)      // keyfunc also blocks tokens whose algorithm doesn't match the key
+	if err != nil {
+		return nil, err
+	}
+
+	// iat is needed for user-wide revocations, sub and jti to know who to revoke
+	if claims.Subject == "" || claims.ID == "" || claims.IssuedAt == nil {
+		return nil, errMissingIdentity
+	}
+	return claims, nil
+}
+
+// short label for why Verify rejected a token, for metrics and error descriptions
+func FailureReason(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "malformed"
+	case errors.Is(err, errUnknownKey), errors.Is(err, errAlgorithmMismatch):
+		return "unknown_key"      // keyfunc refused: unknown kid or algorithm mismatch
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return "invalid_signature"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "not_yet_valid"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return "wrong_issuer"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return "wrong_audience"
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing), errors.Is(err, errMissingIdentity):
+		return "missing_claims"
+	}
+	return "invalid"
+}
@@ -0,0 +1,359 @@
+package auth
+
+// imports
+import (
+	"crypto/ed25519";
+	"crypto/rand";
+	"crypto/rsa";
+	"crypto/x509";
+	"encoding/base64";
+	"encoding/pem";
+	"os";
+	"path/filepath";
+	"strings";
+	"testing";
+	"time";
+	"github.com/golang-jwt/jwt/v5";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func testConfig() config.JWTConfig {
+	return config.JWTConfig{
+		Secret:          testSecret,
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+		Issuer:          "task-manager-api",
+		Audience:        "task-manager-api",
+		ClockSkew:       30 * time.Second,
+	}
+}
+
+// write a pkcs8 pem file for key into dir, named after the key id
+func writeKey(t *testing.T, dir, id string, key any) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	err = os.WriteFile(filepath.Join(dir, id+".pem"), content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// key set with the shared secret, an rsa key and an ed25519 key, active is the one that signs
+func testKeySet(t *testing.T, active string) (*KeySet, config.JWTConfig, *rsa.PrivateKey) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeKey(t, dir, "rsa", rsaKey)
+	writeKey(t, dir, "ed", edKey)
+
+	jwtConfig := testConfig()
+	if active != secretKeyID {
+		jwtConfig.KeysDir = dir
+		jwtConfig.ActiveKeyID = active
+	}
+
+	keys, err := LoadKeySet(jwtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys, jwtConfig, rsaKey
+}
+
+// claims a valid token would carry, tests change what they need
+func validClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":      "6ad2ed6125a9461731177f08",
+		"jti":      "token-id",
+		"iss":      "task-manager-api",
+		"aud":      "task-manager-api",
+		"iat":      now.Unix(),
+		"nbf":      now.Unix(),
+		"exp":      now.Add(15 * time.Minute).Unix(),
+		"username": "bob",
+		"role":     "user",
+	}
+}
+
+// sign claims with method and key, setting kid when it isn't empty
+func forge(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	for _, active := range []string{secretKeyID, "rsa", "ed"} {
+		t.Run(active, func(t *testing.T) {
+			keys, jwtConfig, _ := testKeySet(t, active)
+
+			token, err := NewAccessToken(keys, jwtConfig, "6ad2ed6125a9461731177f08", "bob", "user")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := NewVerifier(keys, jwtConfig).Verify(token)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Subject != "6ad2ed6125a9461731177f08" || claims.Username != "bob" || claims.Role != "user" {
+				t.Errorf("claims = %+v, want the issued user", claims)
+			}
+			if claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+				t.Errorf("claims = %+v, want jti, iat and exp set", claims)
+			}
+			if got := claims.ExpiresAt.Sub(claims.IssuedAt.Time); got != jwtConfig.AccessTokenTTL {
+				t.Errorf("lifetime = %v, want %v", got, jwtConfig.AccessTokenTTL)
+			}
+		})
+	}
+}
+
+func TestVerifyTimeClaims(t *testing.T) {
+	keys, jwtConfig, _ := testKeySet(t, secretKeyID)
+	verifier := NewVerifier(keys, jwtConfig)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		change  func(claims jwt.MapClaims)
+		reason  string      // empty when the token must be accepted
+	}{
+		{"valid", func(claims jwt.MapClaims) {}, ""},
+		{"expired within skew", func(claims jwt.MapClaims) { claims["exp"] = now.Add(-10 * time.Second).Unix() }, ""},
+		{"expired", func(claims jwt.MapClaims) { claims["exp"] = now.Add(-time.Minute).Unix() }, "expired"},
+		{"expired long ago", func(claims jwt.MapClaims) { claims["exp"] = now.Add(-24 * time.Hour).Unix() }, "expired"},
+		{"not valid yet within skew", func(claims jwt.MapClaims) { claims["nbf"] = now.Add(10 * time.Second).Unix() }, ""},
+		{"not valid yet", func(claims jwt.MapClaims) { claims["nbf"] = now.Add(time.Minute).Unix() }, "not_yet_valid"},
+		{"issued in the future", func(claims jwt.MapClaims) { claims["iat"] = now.Add(time.Minute).Unix() }, "not_yet_valid"},
+		{"no expiry", func(claims jwt.MapClaims) { delete(claims, "exp") }, "missing_claims"},
+		{"no issue time", func(claims jwt.MapClaims) { delete(claims, "iat") }, "missing_claims"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := validClaims(now)
+			test.change(claims)
+			token := forge(t, jwt.SigningMethodHS256, secretKeyID, []byte(testSecret), claims)
+
+			_, err := verifier.Verify(token)
+			if test.reason == "" {
+				if err != nil {
+					t.Fatalf("Verify() error = %v, want none", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Verify() accepted the token, want %s", test.reason)
+			}
+			if got := FailureReason(err); got != test.reason {
+				t.Errorf("FailureReason() = %q, want %q (error: %v)", got, test.reason, err)
+			}
+		})
+	}
+}
+
+func TestVerifyIdentityClaims(t *testing.T) {
+	keys, jwtConfig, _ := testKeySet(t, secretKeyID)
+	verifier := NewVerifier(keys, jwtConfig)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		change  func(claims jwt.MapClaims)
+		reason  string
+	}{
+		{"audience list", func(claims jwt.MapClaims) { claims["aud"] = []string{"other-api", "task-manager-api"} }, ""},
+		{"wrong issuer", func(claims jwt.MapClaims) { claims["iss"] = "someone-else" }, "wrong_issuer"},
+		{"no issuer", func(claims jwt.MapClaims) { delete(claims, "iss") }, "missing_claims"},
+		{"wrong audience", func(claims jwt.MapClaims) { claims["aud"] = "other-api" }, "wrong_audience"},
+		{"no audience", func(claims jwt.MapClaims) { delete(claims, "aud") }, "missing_claims"},
+		{"no subject", func(claims jwt.MapClaims) { delete(claims, "sub") }, "missing_claims"},
+		{"no token id", func(claims jwt.MapClaims) { delete(claims, "jti") }, "missing_claims"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := validClaims(now)
+			test.change(claims)
+			token := forge(t, jwt.SigningMethodHS256, secretKeyID, []byte(testSecret), claims)
+
+			_, err := verifier.Verify(token)
+			if test.reason == "" {
+				if err != nil {
+					t.Fatalf("Verify() error = %v, want none", err)
+				}
+				return
+			}
+			if got := FailureReason(err); err == nil || got != test.reason {
+				t.Errorf("Verify() error = %v (reason %q), want reason %q", err, got, test.reason)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsAlgorithmConfusion(t *testing.T) {
+	keys, jwtConfig, rsaKey := testKeySet(t, "rsa")
+	verifier := NewVerifier(keys, jwtConfig)
+	claims := validClaims(time.Now())
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		reason  string
+	}{
+		{
+			// the classic attack: the published rsa public key used as an hmac secret
+			name:   "hs256 signed with the rsa public key",
+			token:  forge(t, jwt.SigningMethodHS256, "rsa", publicPEM, claims),
+			reason: "unknown_key",
+		},
+		{
+			name:   "hs256 signed with the rsa public key der",
+			token:  forge(t, jwt.SigningMethodHS256, "rsa", publicDER, claims),
+			reason: "unknown_key",
+		},
+		{
+			name:   "alg none",
+			token:  forge(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, claims),
+			reason: "unknown_key",
+		},
+		{
+			name:   "alg none without kid",
+			token:  forge(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claims),
+			reason: "unknown_key",
+		},
+		{
+			name:   "rs256 claiming the hmac secret's kid",
+			token:  forge(t, jwt.SigningMethodRS256, secretKeyID, otherKey, claims),
+			reason: "unknown_key",
+		},
+		{
+			name:   "eddsa key id with rs256",
+			token:  forge(t, jwt.SigningMethodRS256, "ed", rsaKey, claims),
+			reason: "unknown_key",
+		},
+		{
+			name:   "rs256 signed by a key that isn't ours",
+			token:  forge(t, jwt.SigningMethodRS256, "rsa", otherKey, claims),
+			reason: "invalid_signature",
+		},
+		{
+			name:   "unknown kid",
+			token:  forge(t, jwt.SigningMethodRS256, "retired", rsaKey, claims),
+			reason: "unknown_key",
+		},
+		{
+			name:   "hs256 with the wrong secret",
+			token:  forge(t, jwt.SigningMethodHS256, secretKeyID, []byte("fedcba9876543210fedcba9876543210"), claims),
+			reason: "invalid_signature",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := verifier.Verify(test.token)
+			if err == nil {
+				t.Fatal("Verify() accepted the token")
+			}
+			if got := FailureReason(err); got != test.reason {
+				t.Errorf("FailureReason() = %q, want %q (error: %v)", got, test.reason, err)
+			}
+		})
+	}
+
+	// the genuine article still works
+	_, err = verifier.Verify(forge(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims))
+	if err != nil {
+		t.Errorf("Verify() of a correctly signed token error = %v", err)
+	}
+}
+
+func TestVerifyRejectsMalformedTokens(t *testing.T) {
+	keys, jwtConfig, _ := testKeySet(t, secretKeyID)
+	verifier := NewVerifier(keys, jwtConfig)
+
+	valid, err := NewAccessToken(keys, jwtConfig, "6ad2ed6125a9461731177f08", "bob", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, ".")
+	segment := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+	}{
+		{"empty", ""},
+		{"not a jwt", "not-a-token"},
+		{"two segments", parts[0] + "." + parts[1]},
+		{"four segments", valid + ".extra"},
+		{"header not base64", "%%%." + parts[1] + "." + parts[2]},
+		{"claims not base64", parts[0] + ".%%%." + parts[2]},
+		{"header not json", segment("not json") + "." + parts[1] + "." + parts[2]},
+		{"claims not json", parts[0] + "." + segment("not json") + "." + parts[2]},
+		{"exp of the wrong type", parts[0] + "." + segment(`{"sub":"x","jti":"y","exp":"tomorrow"}`) + "." + parts[2]},
+		{"aud of the wrong type", parts[0] + "." + segment(`{"sub":"x","jti":"y","aud":42}`) + "." + parts[2]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := verifier.Verify(test.token)
+			if err == nil {
+				t.Fatal("Verify() accepted the token")
+			}
+			if got := FailureReason(err); got != "malformed" {
+				t.Errorf("FailureReason() = %q, want %q (error: %v)", got, "malformed", err)
+			}
+		})
+	}
+
+	// a valid token with its signature cut off or swapped for another token's
+	other, err := NewAccessToken(keys, jwtConfig, "6ad2ed6125a9461731177f09", "alice", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{
+		"no signature":       parts[0] + "." + parts[1] + ".",
+		"borrowed signature": parts[0] + "." + parts[1] + "." + strings.Split(other, ".")[2],
+	} {
+		_, err := verifier.Verify(token)
+		if got := FailureReason(err); err == nil || got != "invalid_signature" {
+			t.Errorf("%s: Verify() error = %v (reason %q), want invalid_signature", name, err, got)
+		}
+	}
+}
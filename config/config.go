@@ -0,0 +1,369 @@
+package config
+
+// imports
+import (
+	"errors";
+	"fmt";
+	"os";
+	"path/filepath";
+	"strconv";
+	"strings";
+	"time";
+	"github.com/pelletier/go-toml/v2";
+	"gopkg.in/yaml.v3";
+)
+
+// settings for the http server
+type ServerConfig struct {
+	Addr                 string            // address the server listens on
+	ShutdownTimeout      time.Duration     // how long in-flight requests may run after SIGINT/SIGTERM
+}
+
+// settings for where data is stored
+type StorageConfig struct {
+	Backend              string            // "mongo" or "memory"
+	TrashRetention       time.Duration     // how long deleted tasks stay in the trash before they are purged
+	PurgeInterval        time.Duration     // how often the trash is checked for tasks past their retention
+}
+
+// settings for the mongodb connection
+type MongoConfig struct {
+	URI                    string          // connection string
+	Database               string          // which database to use
+	TaskCollection         string          // which collection holds tasks
+	TaskHistoryCollection  string          // which collection holds task change history
+	UserCollection         string          // which collection holds users
+	RefreshTokenCollection string          // which collection holds refresh tokens
+	RevocationCollection   string          // which collection holds revoked tokens
+	RoleCollection         string          // which collection holds custom roles
+	ConnectTimeout         time.Duration   // limit for connecting and creating indexes at startup
+	QueryTimeout           time.Duration   // limit for a single query, shorter if the request ends first
+}
+
+// signing settings shared by token generation and validation
+type JWTConfig struct {
+	Secret               string            // hmac secret used to sign and verify access tokens
+	KeysDir              string            // directory of rsa/ed25519 pem keys, replaces the secret for signing
+	ActiveKeyID          string            // key in KeysDir that signs new tokens (file name without .pem)
+	AccessTokenTTL       time.Duration     // lifetime of access tokens
+	RefreshTokenTTL      time.Duration     // lifetime of refresh tokens
+	Issuer               string            // "iss" of issued tokens, tokens from anyone else are rejected
+	Audience             string            // "aud" of issued tokens, tokens meant for anyone else are rejected
+	ClockSkew            time.Duration     // clock difference tolerated when checking exp, nbf and iat
+}
+
+// where access tokens are accepted from besides the Authorization header
+type AuthConfig struct {
+	CookieName           string            // HttpOnly cookie set on login for browser clients, empty to disable
+	CookieSecure         bool              // only send the cookie over https, turn off for local http testing
+	QueryParam           string            // query parameter accepted on GET for SSE/WebSocket handshakes, empty to disable
+}
+
+// settings for exporting opentelemetry traces
+type TracingConfig struct {
+	Exporter             string            // "none", "otlp" or "stdout"
+	Endpoint             string            // otlp/http collector url, e.g. http://localhost:4318
+	ServiceName          string            // service.name resource attribute
+}
+
+// settings for application logs
+type LogConfig struct {
+	Level                string            // "debug", "info", "warn" or "error"
+	Format               string            // "json" or "text"
+}
+
+// all application settings
+type Config struct {
+	Server               ServerConfig
+	Storage              StorageConfig
+	Mongo                MongoConfig
+	JWT                  JWTConfig
+	Auth                 AuthConfig
+	Tracing              TracingConfig
+	Log                  LogConfig
+}
+
+// one configurable value: its key in a config file, its environment variable and how to apply it
+type setting struct {
+	key       string                                  // dotted key in yaml/toml files, e.g. "jwt.secret"
+	env       string                                  // environment variable, e.g. "JWT_SECRET"
+	apply     func(cfg *Config, value string) error   // parse value into cfg
+}
+
+func stringSetting(key, env string, field func(cfg *Config) *string) setting {
+	return setting{key: key, env: env, apply: func(cfg *Config, value string) error {
+		*field(cfg) = value
+		return nil
+	}}
+}
+
+func durationSetting(key, env string, field func(cfg *Config) *time.Duration) setting {
+	return setting{key: key, env: env, apply: func(cfg *Config, value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid duration %q", key, value)
+		}
+		*field(cfg) = duration
+		return nil
+	}}
+}
+
+func boolSetting(key, env string, field func(cfg *Config) *bool) setting {
+	return setting{key: key, env: env, apply: func(cfg *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", key, value)
+		}
+		*field(cfg) = parsed
+		return nil
+	}}
+}
+
+// every supported setting, files and environment variables share the same table
+var settings = []setting{
+	stringSetting("server.addr", "SERVER_ADDR", func(cfg *Config) *string { return &cfg.Server.Addr }),
+	durationSetting("server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT", func(cfg *Config) *time.Duration { return &cfg.Server.ShutdownTimeout }),
+	stringSetting("storage.backend", "STORAGE_BACKEND", func(cfg *Config) *string { return &cfg.Storage.Backend }),
+	durationSetting("storage.trash_retention", "STORAGE_TRASH_RETENTION", func(cfg *Config) *time.Duration { return &cfg.Storage.TrashRetention }),
+	durationSetting("storage.purge_interval", "STORAGE_PURGE_INTERVAL", func(cfg *Config) *time.Duration { return &cfg.Storage.PurgeInterval }),
+	stringSetting("mongo.uri", "MONGO_URI", func(cfg *Config) *string { return &cfg.Mongo.URI }),
+	stringSetting("mongo.database", "MONGO_DATABASE", func(cfg *Config) *string { return &cfg.Mongo.Database }),
+	stringSetting("mongo.task_collection", "MONGO_TASK_COLLECTION", func(cfg *Config) *string { return &cfg.Mongo.TaskCollection }),
+	stringSetting("mongo.task_history_collection", "MONGO_TASK_HISTORY_COLLECTION", func(cfg *Config) *string { return &cfg.Mongo.TaskHistoryCollection }),
+	stringSetting("mongo.user_collection", "MONGO_USER_COLLECTION", func(cfg *Config) *string { return &cfg.Mongo.UserCollection }),
+	stringSetting("mongo.refresh_token_collection", "MONGO_REFRESH_TOKEN_COLLECTION", func(cfg *Config) *string { return &cfg.Mongo.RefreshTokenCollection }),
+	stringSetting("mongo.revocation_collection", "MONGO_REVOCATION_COLLECTION", func(cfg *Config) *string { return &cfg.Mongo.RevocationCollection }),
+	stringSetting("mongo.role_collection", "MONGO_ROLE_COLLECTION", func(cfg *Config) *string { return &cfg.Mongo.RoleCollection }),
+	durationSetting("mongo.connect_timeout", "MONGO_CONNECT_TIMEOUT", func(cfg *Config) *time.Duration { return &cfg.Mongo.ConnectTimeout }),
+	durationSetting("mongo.query_timeout", "MONGO_QUERY_TIMEOUT", func(cfg *Config) *time.Duration { return &cfg.Mongo.QueryTimeout }),
+	stringSetting("jwt.secret", "JWT_SECRET", func(cfg *Config) *string { return &cfg.JWT.Secret }),
+	stringSetting("jwt.keys_dir", "JWT_KEYS_DIR", func(cfg *Config) *string { return &cfg.JWT.KeysDir }),
+	stringSetting("jwt.active_key_id", "JWT_ACTIVE_KEY_ID", func(cfg *Config) *string { return &cfg.JWT.ActiveKeyID }),
+	durationSetting("jwt.access_token_ttl", "JWT_ACCESS_TOKEN_TTL", func(cfg *Config) *time.Duration { return &cfg.JWT.AccessTokenTTL }),
+	durationSetting("jwt.refresh_token_ttl", "JWT_REFRESH_TOKEN_TTL", func(cfg *Config) *time.Duration { return &cfg.JWT.RefreshTokenTTL }),
+	stringSetting("jwt.issuer", "JWT_ISSUER", func(cfg *Config) *string { return &cfg.JWT.Issuer }),
+	stringSetting("jwt.audience", "JWT_AUDIENCE", func(cfg *Config) *string { return &cfg.JWT.Audience }),
+	durationSetting("jwt.clock_skew", "JWT_CLOCK_SKEW", func(cfg *Config) *time.Duration { return &cfg.JWT.ClockSkew }),
+	stringSetting("auth.cookie_name", "AUTH_COOKIE_NAME", func(cfg *Config) *string { return &cfg.Auth.CookieName }),
+	boolSetting("auth.cookie_secure", "AUTH_COOKIE_SECURE", func(cfg *Config) *bool { return &cfg.Auth.CookieSecure }),
+	stringSetting("auth.query_param", "AUTH_QUERY_PARAM", func(cfg *Config) *string { return &cfg.Auth.QueryParam }),
+	stringSetting("log.level", "LOG_LEVEL", func(cfg *Config) *string { return &cfg.Log.Level }),
+	stringSetting("log.format", "LOG_FORMAT", func(cfg *Config) *string { return &cfg.Log.Format }),
+	stringSetting("tracing.exporter", "TRACING_EXPORTER", func(cfg *Config) *string { return &cfg.Tracing.Exporter }),
+	stringSetting("tracing.endpoint", "TRACING_ENDPOINT", func(cfg *Config) *string { return &cfg.Tracing.Endpoint }),
+	stringSetting("tracing.service_name", "TRACING_SERVICE_NAME", func(cfg *Config) *string { return &cfg.Tracing.ServiceName }),
+}
+
+// values used when neither the config file nor the environment set them
+func defaults() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Storage: StorageConfig{
+			Backend:        "mongo",
+			TrashRetention: 30 * 24 * time.Hour,
+			PurgeInterval:  time.Hour,
+		},
+		Mongo: MongoConfig{
+			URI:                    "mongodb://localhost:27017",
+			Database:               "taskdb",
+			TaskCollection:         "tasks",
+			TaskHistoryCollection:  "task_history",
+			UserCollection:         "users",
+			RefreshTokenCollection: "refresh_tokens",
+			RevocationCollection:   "revoked_tokens",
+			RoleCollection:         "roles",
+			ConnectTimeout:         10 * time.Second,
+			QueryTimeout:           5 * time.Second,
+		},
+		JWT: JWTConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 7 * 24 * time.Hour,
+			Issuer:          "task-manager-api",
+			Audience:        "task-manager-api",
+			ClockSkew:       30 * time.Second,
+		},
+		Auth: AuthConfig{
+			CookieSecure: true,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "task-manager-api",
+		},
+	}
+}
+
+// load configuration: defaults, then the optional yaml/toml file at path, then environment variables
+func Load(path string) (*Config, error) {
+
+	cfg := defaults()
+
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range settings {
+			value, ok := values[s.key]
+			if !ok {
+				continue
+			}
+			err = s.apply(cfg, value)
+			if err != nil {
+				return nil, fmt.Errorf("config file %s: %v", path, err)
+			}
+			delete(values, s.key)
+		}
+
+		// anything left over is most likely a typo, fail instead of silently ignoring it
+		for key := range values {
+			return nil, fmt.Errorf("config file %s: unknown setting %q", path, key)
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		err := s.apply(cfg, value)
+		if err != nil {
+			return nil, fmt.Errorf("environment %s: %v", s.env, err)
+		}
+	}
+
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// check that required values are present and sane
+func (cfg *Config) Validate() error {
+
+	var problems []string
+
+	if cfg.Server.Addr == "" {
+		problems = append(problems, "server.addr is required")
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout must be positive")
+	}
+
+	switch cfg.Storage.Backend {
+	case "mongo":
+		if cfg.Mongo.URI == "" {
+			problems = append(problems, "mongo.uri is required")
+		}
+		if cfg.Mongo.Database == "" {
+			problems = append(problems, "mongo.database is required")
+		}
+		if cfg.Mongo.TaskCollection == "" || cfg.Mongo.TaskHistoryCollection == "" || cfg.Mongo.UserCollection == "" ||
+			cfg.Mongo.RefreshTokenCollection == "" || cfg.Mongo.RevocationCollection == "" || cfg.Mongo.RoleCollection == "" {
+			problems = append(problems, "mongo collection names can not be empty")
+		}
+		if cfg.Mongo.ConnectTimeout <= 0 || cfg.Mongo.QueryTimeout <= 0 {
+			problems = append(problems, "mongo.connect_timeout and mongo.query_timeout must be positive")
+		}
+	case "memory":
+	default:
+		problems = append(problems, fmt.Sprintf("storage.backend must be mongo or memory, got %q", cfg.Storage.Backend))
+	}
+	if cfg.Storage.TrashRetention <= 0 || cfg.Storage.PurgeInterval <= 0 {
+		problems = append(problems, "storage.trash_retention and storage.purge_interval must be positive")
+	}
+
+	if cfg.JWT.Secret == "" && cfg.JWT.KeysDir == "" {
+		problems = append(problems, "jwt.secret or jwt.keys_dir is required (set JWT_SECRET or JWT_KEYS_DIR)")
+	} else if cfg.JWT.Secret != "" && len(cfg.JWT.Secret) < 32 {
+		problems = append(problems, "jwt.secret must be at least 32 characters")     // hs256 needs a key as long as its hash
+	}
+	if cfg.JWT.KeysDir != "" && cfg.JWT.ActiveKeyID == "" {
+		problems = append(problems, "jwt.active_key_id is required with jwt.keys_dir")
+	}
+	if cfg.JWT.AccessTokenTTL <= 0 {
+		problems = append(problems, "jwt.access_token_ttl must be positive")
+	}
+	if cfg.JWT.RefreshTokenTTL <= cfg.JWT.AccessTokenTTL {
+		problems = append(problems, "jwt.refresh_token_ttl must be longer than jwt.access_token_ttl")
+	}
+	if cfg.JWT.Issuer == "" || cfg.JWT.Audience == "" {
+		problems = append(problems, "jwt.issuer and jwt.audience can not be empty")
+	}
+	if cfg.JWT.ClockSkew < 0 || cfg.JWT.ClockSkew >= cfg.JWT.AccessTokenTTL {
+		problems = append(problems, "jwt.clock_skew can not be negative or as long as jwt.access_token_ttl")
+	}
+
+	switch strings.ToLower(cfg.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log.level must be debug, info, warn or error, got %q", cfg.Log.Level))
+	}
+	if cfg.Log.Format != "json" && cfg.Log.Format != "text" {
+		problems = append(problems, fmt.Sprintf("log.format must be json or text, got %q", cfg.Log.Format))
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter must be none, otlp or stdout, got %q", cfg.Tracing.Exporter))
+	}
+	if cfg.Tracing.ServiceName == "" {
+		problems = append(problems, "tracing.service_name can not be empty")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// read a yaml or toml file into flat "section.key" -> value pairs
+func readFile(path string) (map[string]string, error) {
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	tree := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &tree)
+	case ".toml":
+		err = toml.Unmarshal(content, &tree)
+	default:
+		return nil, fmt.Errorf("unsupported config file type %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	values := map[string]string{}
+	flatten("", tree, values)
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]any, values map[string]string) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		nested, ok := value.(map[string]any)
+		if ok {
+			flatten(key, nested, values)
+			continue
+		}
+		values[key] = fmt.Sprint(value)
+	}
+}
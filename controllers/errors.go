@@ -0,0 +1,94 @@
+package controllers
+
+// imports
+import (
+	"encoding/json";
+	"errors";
+	"io";
+	"reflect";
+	"strings";
+	"time";
+	"github.com/gin-gonic/gin";
+	"github.com/gin-gonic/gin/binding";
+	"github.com/go-playground/validator/v10";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+)
+
+var ErrMissingBody = data.ValidationError("missing_body", "request body is required")
+
+// token passed AuthMiddleWare but carries no usable user id
+var ErrInvalidTokenClaims = data.UnauthorizedError("invalid_token_claims", "invalid token claims")
+
+// report binding failures under the json field names clients actually send
+func init() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+}
+
+// parse the json body into obj, turning decoder and validator failures into a validation error with field details
+func bindJSON(c *gin.Context, obj any) error {
+
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var timeErr *time.ParseError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]data.FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fields = append(fields, bindingFieldError(fieldErr))
+		}
+		return data.ValidationError("invalid_body", "request body has invalid fields", fields...)
+	case errors.As(err, &typeErr) && typeErr.Type == reflect.TypeOf(time.Time{}):
+		return data.ValidationError("invalid_date", "invalid date format, use ISO 8601 format like '2023-12-31T00:00:00Z'", data.FieldError{
+			Field: typeErr.Field, Code: "invalid", Message: "must be in ISO 8601 format like '2023-12-31T00:00:00Z'",
+		})
+	case errors.As(err, &typeErr):
+		return data.ValidationError("invalid_body", "request body has invalid fields", data.FieldError{
+			Field: typeErr.Field, Code: "invalid_type", Message: "must be a " + typeErr.Type.String(),
+		})
+	case errors.As(err, &timeErr):
+		return data.ValidationError("invalid_date", "invalid date format, use ISO 8601 format like '2023-12-31T00:00:00Z'")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return data.ValidationError("malformed_json", "request body is not valid json")
+	case errors.Is(err, io.EOF):
+		return ErrMissingBody
+	}
+	return data.ValidationError("invalid_body", err.Error())
+}
+
+// describe one failed binding rule
+func bindingFieldError(fieldErr validator.FieldError) data.FieldError {
+	message := "failed the " + fieldErr.Tag() + " rule"
+	switch fieldErr.Tag() {
+	case "required":
+		message = "is required"
+	case "oneof":
+		message = "must be one of: " + fieldErr.Param()
+	}
+	return data.FieldError{Field: fieldErr.Field(), Code: fieldErr.Tag(), Message: message}
+}
+
+// hand the error to middleware.Errors, which writes the response
+func respondError(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
@@ -0,0 +1,66 @@
+package controllers
+
+// imports
+import (
+	"strconv";
+	"strings";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+var ErrInvalidIfMatch = data.ValidationError("invalid_if_match", "If-Match must be * or a list of entity tags")
+
+// strong etag of a task, its version is enough as ids never repeat
+func taskETag(task *models.Task) string {
+	return `"` + strconv.FormatInt(task.Version, 10) + `"`
+}
+
+// versions the client accepts from If-Match, data.AnyVersion when the header is missing or "*"
+func ifMatchVersions(c *gin.Context) (data.VersionMatch, error) {
+
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return data.AnyVersion, nil
+	}
+
+	// If-Match uses strong comparison, weak or foreign tags can never match and are skipped
+	versions := data.VersionMatch{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			return nil, ErrInvalidIfMatch      // "*" can't be part of a list
+		}
+		if strings.HasPrefix(tag, "W/") || len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			continue
+		}
+		version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+		if err == nil && version >= 0 {
+			versions = append(versions, version)
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, data.ErrTaskVersionMismatch
+	}
+	return versions, nil
+}
+
+// whether If-None-Match lists etag, compared weakly as the spec asks for GET
+func ifNoneMatch(c *gin.Context, etag string) bool {
+
+	header := strings.TrimSpace(c.GetHeader("If-None-Match"))
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package controllers
+
+// imports
+import (
+	"net/http";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/health";
+)
+
+type HealthController struct {
+	checker *health.Checker       // readiness checks of the server's dependencies
+}
+
+func NewHealthController(checker *health.Checker) *HealthController {
+	return &HealthController{checker: checker}         // return new controller instance 
+}
+
+// liveness: the process is up and serving http, dependencies are not checked
+func (healthContr *HealthController) Liveness(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, health.Report{Status: "ok"})
+}
+
+// readiness: every dependency is usable, 503 while one isn't
+func (healthContr *HealthController) Readiness(c *gin.Context) {
+
+	report := healthContr.checker.Ready(c.Request.Context())
+
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
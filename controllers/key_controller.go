@@ -0,0 +1,23 @@
+package controllers
+
+// imports
+import (
+	"net/http";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/auth";
+)
+
+type KeyController struct {
+	keys *auth.KeySet       // keys access tokens are signed and verified with
+}
+
+func NewKeyController(keys *auth.KeySet) *KeyController {
+	return &KeyController{keys: keys}         // return new controller instance 
+}
+
+func (keyContr *KeyController) JWKS(c *gin.Context) {
+
+	// verifiers may cache the set for a while, rotation keeps old keys published until their tokens expire
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, keyContr.keys.JWKS())
+}
@@ -0,0 +1,136 @@
+package controllers
+
+// imports
+import (
+	"net/http";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+type RoleController struct {
+	roleService *data.RoleService       // service layer for roles and role assignment
+}
+
+func NewRoleController(service *data.RoleService) *RoleController {
+	return &RoleController{roleService: service}         // return new controller instance
+}
+
+func (roleContr *RoleController) GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": models.AllPermissions})     // every permission a role can grant
+}
+
+func (roleContr *RoleController) GetRoles(c *gin.Context) {
+
+	roles, err := roleContr.roleService.ListRoles(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})     // built-in roles first, then custom ones by name
+}
+
+func (roleContr *RoleController) GetRole(c *gin.Context) {
+
+	role, err := roleContr.roleService.GetRole(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+func (roleContr *RoleController) CreateRole(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	var role models.Role
+	err := bindJSON(c, &role)    // parse request body into role struct
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// create role through service layer
+	err = roleContr.roleService.CreateRole(c.Request.Context(), actor, &role)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)  // return created role with 201 status
+}
+
+func (roleContr *RoleController) UpdateRole(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	var role models.Role
+	err := bindJSON(c, &role)    // parse request body into role struct, the name comes from the path
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// replace role through service layer
+	err = roleContr.roleService.UpdateRole(c.Request.Context(), actor, c.Param("name"), &role)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message":"role updated successfully", "updated role":&role})      // success response
+}
+
+func (roleContr *RoleController) DeleteRole(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	// delete role through service layer
+	err := roleContr.roleService.DeleteRole(c.Request.Context(), actor, c.Param("name"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message":"role deleted successfully"})    // success response
+}
+
+func (roleContr *RoleController) AssignRole(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	var assignment models.RoleAssignment
+	err := bindJSON(c, &assignment)    // parse request body into assignment struct
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// change the user's role through service layer
+	err = roleContr.roleService.AssignRole(c.Request.Context(), actor, c.Param("id"), assignment.Role)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role assigned successfully", "role": assignment.Role})
+}
@@ -2,12 +2,14 @@ package controllers
 
 // imports
 import (
+	"io";
 	"net/http";
-	"strings";
+	"strconv";
+	"time";
 	"github.com/gin-gonic/gin";
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/middleware";
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
-	"go.mongodb.org/mongo-driver/bson/primitive";
 )
 
 type TaskController struct {
@@ -18,48 +20,106 @@ func NewTaskController(service data.TaskManager) *TaskController {
 	return &TaskController{taskService: service}         // return new controller instance 
 }
 
+// the acting user, as authenticated by AuthMiddleWare
+func currentActor(c *gin.Context) (models.Actor, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok || principal.UserID == "" {
+		return models.Actor{}, false      // token without a user id, can't tell who owns what
+	}
+	return principal.Actor(), true
+}
+
+// query parameter that can't be parsed, reported like the service's own query errors
+func invalidParam(param, message string) error {
+	return data.ValidationError(data.ErrInvalidTaskQuery.Code, "invalid task query: "+message, data.FieldError{Field: param, Code: "invalid", Message: message})
+}
+
+// build a task query from ?limit=&cursor=&sort=&order=&status=&due_before=&due_after=
+func parseTaskQuery(c *gin.Context) (data.TaskQuery, error) {
+
+	query := data.TaskQuery{
+		Cursor: c.Query("cursor"),
+		SortBy: c.Query("sort"),
+		Status: c.Query("status"),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil {
+			return query, invalidParam("limit", "limit must be a number")
+		}
+		query.Limit = value
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		query.SortDesc = true
+	default:
+		return query, invalidParam("order", "order must be asc or desc")
+	}
+
+	for param, field := range map[string]*time.Time{"due_before": &query.DueBefore, "due_after": &query.DueAfter} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, invalidParam(param, param + " must be in ISO 8601 format like '2023-12-31T00:00:00Z'")
+		}
+		*field = parsed
+	}
+
+	return query, nil
+}
+
 func (taskcontr *TaskController) CreateTask(c *gin.Context) {
 	
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
 	var task models.Task
-	err := c.ShouldBindJSON(&task)    // parse request body into task struct
-	if err != nil {
-		// handle specific date format error case
-		if strings.Contains(err.Error(), "numeric literal") {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Invalid date format. Use ISO 8601 format like '2023-12-31T00:00:00Z'",
-				"example": gin.H{
-					"due_date": "2023-12-31T00:00:00Z",
-				},
-			})
-			return
-		}
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	err := bindJSON(c, &task)    // parse request body into task struct
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
 	// create task through service layer
-	createdTask, err := taskcontr.taskService.CreateTask(&task)
+	createdTask, err := taskcontr.taskService.CreateTask(c.Request.Context(), actor, &task)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	c.Header("ETag", taskETag(createdTask))
 	c.JSON(http.StatusCreated, createdTask)  // return created task with 201 status
 }
 
 func (taskcontr *TaskController) DeleteTask(c *gin.Context) {
 	
-	id := c.Param("id")
-	_, err := primitive.ObjectIDFromHex(id)       // validate it is a valid ObjectID
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	id := c.Param("id")      // the service layer rejects ids in the wrong format
+
+	versions, err := ifMatchVersions(c)      // only delete the version the client has seen, if it says which
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID format"})
+		respondError(c, err)
 		return
 	}
 
 	// delete task through service layer
-	err = taskcontr.taskService.DeleteTask(id)
+	err = taskcontr.taskService.DeleteTask(c.Request.Context(), actor, id, versions)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -68,34 +128,84 @@ func (taskcontr *TaskController) DeleteTask(c *gin.Context) {
 
 func (taskcontr *TaskController) GetAllTasks(c *gin.Context) {
 	
-	// get all tasks through service layer
-	tasks, err := taskcontr.taskService.GetAllTasks()
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	query, err := parseTaskQuery(c)      // read paging, sorting and filters from the query string
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// get one page of tasks visible to the user through service layer
+	page, err := taskcontr.taskService.GetAllTasks(c.Request.Context(), actor, query)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)     // return tasks, next cursor and total
+}
+
+func (taskcontr *TaskController) SearchTasks(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	query := c.Query("q")
+	if query == "" {
+		respondError(c, invalidParam("q", "search query q is required"))
+		return
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			respondError(c, invalidParam("limit", "limit must be a number"))
+			return
+		}
+		limit = parsed
+	}
+
+	// search tasks visible to the user through service layer
+	results, err := taskcontr.taskService.SearchTasks(c.Request.Context(), actor, query, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, tasks)     // return all tasks
+	c.JSON(http.StatusOK, gin.H{"results": results})     // return ranked results with highlights
 }
 
 func (taskcontr *TaskController) GetTaskByID(c *gin.Context) {
 	
-	id := c.Param("id")
-	_, err := primitive.ObjectIDFromHex(id)       // validate it is a valid ObjectID
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID format"})
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
 		return
 	}
 
+	id := c.Param("id")      // the service layer rejects ids in the wrong format
+
 	// get specific task through service layer
-	task, err := taskcontr.taskService.GetTaskByID(id)
+	task, err := taskcontr.taskService.GetTaskByID(c.Request.Context(), actor, id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	if task == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	// the client's copy is still current, don't send it again
+	etag := taskETag(task)
+	c.Header("ETag", etag)
+	if ifNoneMatch(c, etag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
@@ -104,41 +214,170 @@ func (taskcontr *TaskController) GetTaskByID(c *gin.Context) {
 
 func (taskcontr *TaskController) UpdateTask(c *gin.Context) {
 	
-	id := c.Param("id")
-	_, err := primitive.ObjectIDFromHex(id)       // validate it is a valid ObjectID
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	id := c.Param("id")      // the service layer rejects ids in the wrong format
+
+	versions, err := ifMatchVersions(c)      // only overwrite the version the client has seen, if it says which
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID format"})
+		respondError(c, err)
 		return
 	}
 
 	var taskUpdate models.Task
-	err = c.ShouldBindJSON(&taskUpdate)    // parse request body into task struct
-	if err != nil {
-		// handle specific date format error case
-		if strings.Contains(err.Error(), "numeric literal") {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Invalid date format. Use ISO 8601 format like '2023-12-31T00:00:00Z'",
-				"example": gin.H{
-					"due_date": "2025-7-16T00:00:00Z",
-				},
-			})
-			return
-		}
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	err = bindJSON(c, &taskUpdate)    // parse request body into task struct
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
 	// update task through service layer
-	task, err := taskcontr.taskService.UpdateTask(id, &taskUpdate)
+	task, err := taskcontr.taskService.UpdateTask(c.Request.Context(), actor, id, &taskUpdate, versions)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"message":"task updated successfully", "updated task":&task})      // success response
+}
+
+func (taskcontr *TaskController) PatchTask(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	id := c.Param("id")      // the service layer rejects ids in the wrong format
+
+	versions, err := ifMatchVersions(c)      // only patch the version the client has seen, if it says which
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	if task == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	// the content type says how to read the patch, the service layer rejects anything else
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondError(c, data.ValidationError("invalid_body", "failed to read request body"))
+		return
+	}
+	if len(body) == 0 {
+		respondError(c, ErrMissingBody)
 		return
 	}
 
+	// patch task through service layer
+	task, err := taskcontr.taskService.PatchTask(c.Request.Context(), actor, id, data.TaskPatch{Type: c.ContentType(), Body: body}, versions)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("ETag", taskETag(task))
 	c.JSON(http.StatusOK, gin.H{"message":"task updated successfully", "updated task":&task})      // success response
-}
\ No newline at end of file
+}
+
+func (taskcontr *TaskController) GetTaskHistory(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	id := c.Param("id")      // the service layer rejects ids in the wrong format
+
+	// get every recorded change of the task through service layer
+	revisions, err := taskcontr.taskService.GetTaskHistory(c.Request.Context(), actor, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": revisions})     // return changes, oldest first
+}
+
+func (taskcontr *TaskController) RestoreTaskRevision(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	id := c.Param("id")      // the service layer rejects ids in the wrong format
+
+	revision, err := strconv.ParseInt(c.Param("rev"), 10, 64)
+	if err != nil || revision < 1 {
+		respondError(c, data.ValidationError("invalid_revision", "revision must be a positive number", data.FieldError{Field: "rev", Code: "invalid", Message: "must be a positive number"}))
+		return
+	}
+
+	versions, err := ifMatchVersions(c)      // only restore over the version the client has seen, if it says which
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// restore task through service layer
+	task, err := taskcontr.taskService.RestoreTaskRevision(c.Request.Context(), actor, id, revision, versions)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"message":"task restored successfully", "updated task":&task})      // success response
+}
+
+func (taskcontr *TaskController) GetDeletedTasks(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	// get the caller's trash through service layer
+	tasks, err := taskcontr.taskService.GetDeletedTasks(c.Request.Context(), actor)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks})     // return deleted tasks, most recent first
+}
+
+func (taskcontr *TaskController) RestoreDeletedTask(c *gin.Context) {
+
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	id := c.Param("id")      // the service layer rejects ids in the wrong format
+
+	versions, err := ifMatchVersions(c)      // only restore the version the client has seen in the trash, if it says which
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// take task out of the trash through service layer
+	task, err := taskcontr.taskService.RestoreDeletedTask(c.Request.Context(), actor, id, versions)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"message":"task restored successfully", "restored task":&task})      // success response
+}
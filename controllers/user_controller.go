@@ -4,33 +4,45 @@ package controllers
 import (
 	"net/http";
 	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/middleware";
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
 )
 
 type UserController struct {
 	userService data.UserService       // service layer for user operations
+	authConfig  config.AuthConfig      // whether access tokens are also handed out as a cookie
 }
 
-func NewUserController(service data.UserService) *UserController {
-	return &UserController{userService: service}         // return new controller instance 
+func NewUserController(service data.UserService, authConfig config.AuthConfig) *UserController {
+	return &UserController{userService: service, authConfig: authConfig}         // return new controller instance 
+}
+
+// hand the access token to browser clients as an HttpOnly cookie too, if enabled.
+// SameSite=Strict keeps other sites from making requests with it
+func (userContr *UserController) setTokenCookie(c *gin.Context, token string, maxAge int) {
+	if userContr.authConfig.CookieName == "" {
+		return
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(userContr.authConfig.CookieName, token, maxAge, "/", "", userContr.authConfig.CookieSecure, true)
 }
 
 func (userContr *UserController) Register(c *gin.Context) {
 	
-	var user models.User
-	err := c.ShouldBindJSON(&user)    // parse request body into user struct
+	var registration models.Registration
+	err := bindJSON(c, &registration)    // parse request body into registration struct
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})     // returns parsing errors
+		respondError(c, err)
 		return
 	}
 
-	// create user through service layer
-	err = userContr.userService.Register(&user)
+	// create user through service layer, id and role are never taken from the client
+	user := models.User{Username: registration.Username, Password: registration.Password}
+	err = userContr.userService.Register(c.Request.Context(), &user)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
@@ -41,24 +53,26 @@ func (userContr *UserController) Login(c *gin.Context) {
 
 	var credentials models.Credentials
 
-	err := c.ShouldBindJSON(&credentials)       // parse request body into credentials struct
+	err := bindJSON(c, &credentials)       // parse request body into credentials struct
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
 	// authenticate user through service layer
-	token, user, err := userContr.userService.Login(&credentials)
+	tokens, user, err := userContr.userService.Login(c.Request.Context(), &credentials)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error":err.Error()})     
+		respondError(c, err)
 		return
 	}
 
-	// return token, user info (excluding sensitive data)
+	userContr.setTokenCookie(c, tokens.AccessToken, int(tokens.ExpiresIn))
+
+	// return tokens, user info (excluding sensitive data)
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+		"token": tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in": tokens.ExpiresIn,
 		"user": gin.H{
 			"id": 		 user.ID,
 			"username":  user.Username,
@@ -67,14 +81,85 @@ func (userContr *UserController) Login(c *gin.Context) {
 	})
 }
 
+func (userContr *UserController) RefreshToken(c *gin.Context) {
+
+	var request models.RefreshRequest
+
+	err := bindJSON(c, &request)       // parse request body into refresh request struct
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// rotate refresh token through service layer
+	tokens, err := userContr.userService.RefreshSession(c.Request.Context(), request.RefreshToken)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	userContr.setTokenCookie(c, tokens.AccessToken, int(tokens.ExpiresIn))
+	c.JSON(http.StatusOK, tokens)      // return new access and refresh tokens
+}
+
+func (userContr *UserController) Logout(c *gin.Context) {
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
+	var request models.LogoutRequest
+
+	// body is optional, only needed to also revoke the refresh token
+	if c.Request.ContentLength != 0 {
+		err := bindJSON(c, &request)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	// revoke tokens through service layer
+	err := userContr.userService.Logout(c.Request.Context(), principal.UserID, principal.TokenID, principal.ExpiresAt, request.RefreshToken)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	userContr.setTokenCookie(c, "", -1)      // delete it
+	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+}
+
+func (userContr *UserController) RevokeSessions(c *gin.Context) {
+
+	userID := c.Param("id")       // get user id from request parameter
+
+	// revoke every session of the user through service layer
+	err := userContr.userService.RevokeAllSessions(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "all sessions revoked for user"})
+}
+
 func (userContr *UserController) PromoteAdmin(c *gin.Context) {
     
+	actor, ok := currentActor(c)
+	if !ok {
+		respondError(c, ErrInvalidTokenClaims)
+		return
+	}
+
     userID := c.Param("id")       // get user id from request parameter
     
     // promote user through service layer
-    err := userContr.userService.PromoteUserToAdmin(userID)
+    err := userContr.userService.PromoteUserToAdmin(c.Request.Context(), actor, userID)
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        respondError(c, err)
         return
     }
     
@@ -0,0 +1,105 @@
+package data
+
+// imports
+import (
+	"errors";
+	"go.mongodb.org/mongo-driver/bson/primitive";
+)
+
+// kinds of failure, each one maps to a single http status, match them with errors.Is
+var (
+	ErrNotFound      = errors.New("not found")               // the thing asked for doesn't exist (or isn't visible to the caller)
+	ErrValidation    = errors.New("validation failed")       // the caller sent something invalid
+	ErrConflict      = errors.New("conflict")                // the request clashes with the current state
+	ErrUnauthorized  = errors.New("unauthorized")            // the caller isn't (or is no longer) authenticated
+	ErrForbidden     = errors.New("forbidden")               // the caller is known but not allowed to do this
+	ErrPrecondition  = errors.New("precondition failed")     // the caller's view of the data is out of date (If-Match)
+	ErrUnsupportedMediaType = errors.New("unsupported media type")      // the body is in a format this endpoint doesn't take
+	ErrInternal      = errors.New("internal error")          // storage or other failures the caller can't fix
+)
+
+// one problem with one field of the request
+type FieldError struct {
+	Field    string    `json:"field"`       // json name of the field, or query parameter
+	Code     string    `json:"code"`        // stable code, e.g. "required", "invalid"
+	Message  string    `json:"message"`     // human readable explanation
+}
+
+// error returned by services, carries everything needed to render an error response
+type Error struct {
+	Kind     error          // one of ErrNotFound, ErrValidation, ...
+	Code     string         // stable, machine readable code like "task_not_found", clients can branch on it
+	Message  string         // safe to show to the caller
+	Fields   []FieldError   // per field details for validation errors
+	Cause    error          // underlying error, logged but never shown to the caller
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+// lets errors.Is match both the kind (errors.Is(err, ErrNotFound)) and the cause
+func (e *Error) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Cause}
+}
+
+// errors with the same code are the same error, even when built separately with different details
+func (e *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Code == e.Code
+}
+
+func NotFoundError(code, message string) *Error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+func ValidationError(code, message string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: code, Message: message, Fields: fields}
+}
+
+func ConflictError(code, message string) *Error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message}
+}
+
+func UnauthorizedError(code, message string) *Error {
+	return &Error{Kind: ErrUnauthorized, Code: code, Message: message}
+}
+
+func ForbiddenError(code, message string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrForbidden, Code: code, Message: message, Fields: fields}
+}
+
+func PreconditionError(code, message string) *Error {
+	return &Error{Kind: ErrPrecondition, Code: code, Message: message}
+}
+
+func UnsupportedMediaTypeError(code, message string) *Error {
+	return &Error{Kind: ErrUnsupportedMediaType, Code: code, Message: message}
+}
+
+// wrap an unexpected failure, the caller only ever sees "internal server error"
+func InternalError(cause error) *Error {
+	return &Error{Kind: ErrInternal, Code: "internal", Message: "internal server error", Cause: cause}
+}
+
+// errors shared by every TaskManager implementation
+var (
+	ErrTaskNotFound    = NotFoundError("task_not_found", "no task found with this id")
+	ErrInvalidTaskID   = ValidationError("invalid_task_id", "invalid task id format", FieldError{Field: "id", Code: "invalid", Message: "must be a 24 character hex object id"})
+	ErrTaskVersionMismatch = PreconditionError("task_version_mismatch", "task was changed since it was read, fetch it again and retry")
+)
+
+// parse a task id, both implementations use mongodb's id format
+func parseTaskID(taskID string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidTaskID
+	}
+	return objID, nil
+}
@@ -0,0 +1,38 @@
+package data
+
+// imports
+import (
+	"context";
+	"fmt";
+	"go.mongodb.org/mongo-driver/bson";
+	"go.mongodb.org/mongo-driver/mongo";
+)
+
+// error if any of the named indexes no longer exists on the collection
+func checkIndexes(ctx context.Context, collection *mongo.Collection, names []string) error {
+
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var existing []bson.M
+	err = cursor.All(ctx, &existing)
+	if err != nil {
+		return err
+	}
+
+	found := map[string]bool{}
+	for _, index := range existing {
+		name, _ := index["name"].(string)
+		found[name] = true
+	}
+
+	for _, name := range names {
+		if !found[name] {
+			return fmt.Errorf("index %s missing on %s", name, collection.Name())
+		}
+	}
+
+	return nil
+}
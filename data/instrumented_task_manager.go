@@ -0,0 +1,103 @@
+package data
+
+// imports
+import (
+	"context";
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/metrics";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/tracing";
+)
+
+// TaskManager that traces every call to the wrapped implementation and records its latency and errors
+type InstrumentedTaskManager struct {
+	next         TaskManager      // mongodb or in-memory implementation doing the work
+}
+
+func NewInstrumentedTaskManager(next TaskManager) *InstrumentedTaskManager {
+	return &InstrumentedTaskManager{next: next}
+}
+
+func (taskServ *InstrumentedTaskManager) CreateTask(ctx context.Context, actor models.Actor, task *models.Task) (created *models.Task, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.CreateTask")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "CreateTask", time.Now(), &err)
+	return taskServ.next.CreateTask(ctx, actor, task)
+}
+
+func (taskServ *InstrumentedTaskManager) DeleteTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch) (err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.DeleteTask")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "DeleteTask", time.Now(), &err)
+	return taskServ.next.DeleteTask(ctx, actor, taskID, versions)
+}
+
+func (taskServ *InstrumentedTaskManager) GetAllTasks(ctx context.Context, actor models.Actor, query TaskQuery) (page *TaskPage, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.GetAllTasks")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "GetAllTasks", time.Now(), &err)
+	return taskServ.next.GetAllTasks(ctx, actor, query)
+}
+
+func (taskServ *InstrumentedTaskManager) GetDeletedTasks(ctx context.Context, actor models.Actor) (tasks []models.Task, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.GetDeletedTasks")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "GetDeletedTasks", time.Now(), &err)
+	return taskServ.next.GetDeletedTasks(ctx, actor)
+}
+
+func (taskServ *InstrumentedTaskManager) GetTaskByID(ctx context.Context, actor models.Actor, taskID string) (task *models.Task, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.GetTaskByID")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "GetTaskByID", time.Now(), &err)
+	return taskServ.next.GetTaskByID(ctx, actor, taskID)
+}
+
+func (taskServ *InstrumentedTaskManager) GetTaskHistory(ctx context.Context, actor models.Actor, taskID string) (revisions []models.TaskRevision, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.GetTaskHistory")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "GetTaskHistory", time.Now(), &err)
+	return taskServ.next.GetTaskHistory(ctx, actor, taskID)
+}
+
+func (taskServ *InstrumentedTaskManager) PatchTask(ctx context.Context, actor models.Actor, taskID string, patch TaskPatch, versions VersionMatch) (patched *models.Task, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.PatchTask")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "PatchTask", time.Now(), &err)
+	return taskServ.next.PatchTask(ctx, actor, taskID, patch, versions)
+}
+
+func (taskServ *InstrumentedTaskManager) PurgeDeletedTasks(ctx context.Context, deletedBefore time.Time) (purged int64, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.PurgeDeletedTasks")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "PurgeDeletedTasks", time.Now(), &err)
+	return taskServ.next.PurgeDeletedTasks(ctx, deletedBefore)
+}
+
+func (taskServ *InstrumentedTaskManager) RestoreDeletedTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch) (restored *models.Task, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.RestoreDeletedTask")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "RestoreDeletedTask", time.Now(), &err)
+	return taskServ.next.RestoreDeletedTask(ctx, actor, taskID, versions)
+}
+
+func (taskServ *InstrumentedTaskManager) RestoreTaskRevision(ctx context.Context, actor models.Actor, taskID string, revision int64, versions VersionMatch) (restored *models.Task, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.RestoreTaskRevision")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "RestoreTaskRevision", time.Now(), &err)
+	return taskServ.next.RestoreTaskRevision(ctx, actor, taskID, revision, versions)
+}
+
+func (taskServ *InstrumentedTaskManager) SearchTasks(ctx context.Context, actor models.Actor, query string, limit int) (results []TaskSearchResult, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.SearchTasks")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "SearchTasks", time.Now(), &err)
+	return taskServ.next.SearchTasks(ctx, actor, query, limit)
+}
+
+func (taskServ *InstrumentedTaskManager) UpdateTask(ctx context.Context, actor models.Actor, taskID string, task *models.Task, versions VersionMatch) (updated *models.Task, err error) {
+	ctx, span := tracing.Start(ctx, "TaskManager.UpdateTask")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("task_manager", "UpdateTask", time.Now(), &err)
+	return taskServ.next.UpdateTask(ctx, actor, taskID, task, versions)
+}
@@ -0,0 +1,95 @@
+package data
+
+// imports
+import (
+	"context";
+	"sync";
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+// in-memory refresh token storage, safe for concurrent use (tests and local development)
+type InMemoryRefreshTokenStore struct {
+	mu        sync.Mutex                           // guards tokens
+	tokens    map[string]models.RefreshToken       // tokens keyed by hash
+}
+
+// create a new empty in-memory refresh token store
+func NewInMemoryRefreshTokenStore() *InMemoryRefreshTokenStore {
+	return &InMemoryRefreshTokenStore{tokens: make(map[string]models.RefreshToken)}
+}
+
+func (tokenStore *InMemoryRefreshTokenStore) Save(ctx context.Context, token *models.RefreshToken) error {
+
+	tokenStore.mu.Lock()
+	defer tokenStore.mu.Unlock()
+
+	// drop expired tokens on the way, like the mongodb ttl index does
+	now := time.Now()
+	for id, stored := range tokenStore.tokens {
+		if now.After(stored.ExpiresAt) {
+			delete(tokenStore.tokens, id)
+		}
+	}
+
+	tokenStore.tokens[token.ID] = *token
+	return nil
+}
+
+func (tokenStore *InMemoryRefreshTokenStore) Find(ctx context.Context, tokenID string) (*models.RefreshToken, error) {
+
+	tokenStore.mu.Lock()
+	defer tokenStore.mu.Unlock()
+
+	token, exists := tokenStore.tokens[tokenID]
+	if !exists {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	return &token, nil     // return a copy of the stored token
+}
+
+func (tokenStore *InMemoryRefreshTokenStore) MarkUsed(ctx context.Context, tokenID string) (bool, error) {
+
+	tokenStore.mu.Lock()
+	defer tokenStore.mu.Unlock()
+
+	token, exists := tokenStore.tokens[tokenID]
+	if !exists || token.Used || token.Revoked {
+		return false, nil
+	}
+
+	token.Used = true
+	tokenStore.tokens[tokenID] = token
+	return true, nil
+}
+
+func (tokenStore *InMemoryRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+
+	tokenStore.mu.Lock()
+	defer tokenStore.mu.Unlock()
+
+	for id, token := range tokenStore.tokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+			tokenStore.tokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+func (tokenStore *InMemoryRefreshTokenStore) RevokeUser(ctx context.Context, userID string) error {
+
+	tokenStore.mu.Lock()
+	defer tokenStore.mu.Unlock()
+
+	for id, token := range tokenStore.tokens {
+		if token.UserID == userID {
+			token.Revoked = true
+			tokenStore.tokens[id] = token
+		}
+	}
+
+	return nil
+}
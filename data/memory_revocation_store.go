@@ -0,0 +1,106 @@
+package data
+
+// imports
+import (
+	"context";
+	"sync";
+	"time";
+)
+
+// in-memory revocation storage, safe for concurrent use (tests and local development)
+type InMemoryRevocationStore struct {
+	mu        sync.RWMutex                         // guards tokens and users
+	tokens    map[string]time.Time                 // revoked jti -> token expiry
+	users     map[string]revocationRecord          // user id -> latest user-wide revocation
+	stop      chan struct{}                        // closed to stop garbage collection
+	stopOnce  sync.Once                            // makes Close safe to call twice
+}
+
+// create a new in-memory revocation store, expired entries are dropped in the background until Close
+func NewInMemoryRevocationStore() *InMemoryRevocationStore {
+	revocations := &InMemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]revocationRecord),
+		stop:   make(chan struct{}),
+	}
+
+	go revocations.collectGarbage(revocationGCInterval)
+	return revocations
+}
+
+func (revocations *InMemoryRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+
+	revocations.tokens[tokenID] = expiresAt
+	return nil
+}
+
+func (revocations *InMemoryRevocationStore) RevokeUser(ctx context.Context, userID string, revokedAt, expiresAt time.Time) error {
+
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+
+	revocations.users[userID] = revocationRecord{
+		ID:        "user:" + userID,
+		RevokedAt: revokedAt.Truncate(time.Second),      // stored with the precision it is compared at
+		ExpiresAt: expiresAt,
+	}
+	return nil
+}
+
+func (revocations *InMemoryRevocationStore) IsRevoked(ctx context.Context, tokenID, userID string, issuedAt time.Time) (bool, error) {
+
+	revocations.mu.RLock()
+	defer revocations.mu.RUnlock()
+
+	now := time.Now()
+
+	expiresAt, exists := revocations.tokens[tokenID]
+	if exists && now.Before(expiresAt) {
+		return true, nil
+	}
+
+	record, exists := revocations.users[userID]
+	if exists && now.Before(record.ExpiresAt) && issuedBeforeRevocation(issuedAt, record.RevokedAt) {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// periodically drop entries whose tokens have expired anyway
+func (revocations *InMemoryRevocationStore) collectGarbage(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-revocations.stop:
+			return
+		case now := <-ticker.C:
+			revocations.mu.Lock()
+			for tokenID, expiresAt := range revocations.tokens {
+				if now.After(expiresAt) {
+					delete(revocations.tokens, tokenID)
+				}
+			}
+			for userID, record := range revocations.users {
+				if now.After(record.ExpiresAt) {
+					delete(revocations.users, userID)
+				}
+			}
+			revocations.mu.Unlock()
+		}
+	}
+}
+
+// stop background garbage collection
+func (revocations *InMemoryRevocationStore) Close() error {
+	revocations.stopOnce.Do(func() {
+		close(revocations.stop)
+	})
+	return nil
+}
@@ -0,0 +1,100 @@
+package data
+
+// imports
+import (
+	"context";
+	"sort";
+	"sync";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+// in-memory role storage, safe for concurrent use (tests and local development)
+type InMemoryRoleStore struct {
+	mu        sync.RWMutex                 // guards roles
+	roles     map[string]models.Role       // roles keyed by name
+}
+
+// create a new empty in-memory role store
+func NewInMemoryRoleStore() *InMemoryRoleStore {
+	return &InMemoryRoleStore{roles: make(map[string]models.Role)}
+}
+
+// copy of role that doesn't share its permissions with the stored one
+func cloneRole(role models.Role) models.Role {
+	role.Permissions = append([]string{}, role.Permissions...)
+	return role
+}
+
+func (roleStore *InMemoryRoleStore) List(ctx context.Context) ([]models.Role, error) {
+
+	roleStore.mu.RLock()
+	defer roleStore.mu.RUnlock()
+
+	roles := make([]models.Role, 0, len(roleStore.roles))
+	for _, role := range roleStore.roles {
+		roles = append(roles, cloneRole(role))
+	}
+
+	// same order as the mongodb store
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+
+func (roleStore *InMemoryRoleStore) Find(ctx context.Context, name string) (*models.Role, error) {
+
+	roleStore.mu.RLock()
+	defer roleStore.mu.RUnlock()
+
+	role, exists := roleStore.roles[name]
+	if !exists {
+		return nil, ErrRoleNotFound
+	}
+
+	role = cloneRole(role)
+	return &role, nil
+}
+
+func (roleStore *InMemoryRoleStore) Insert(ctx context.Context, role *models.Role) error {
+
+	roleStore.mu.Lock()
+	defer roleStore.mu.Unlock()
+
+	_, exists := roleStore.roles[role.Name]
+	if exists {
+		return ErrRoleExists
+	}
+
+	roleStore.roles[role.Name] = cloneRole(*role)
+	return nil
+}
+
+func (roleStore *InMemoryRoleStore) Replace(ctx context.Context, role *models.Role) error {
+
+	roleStore.mu.Lock()
+	defer roleStore.mu.Unlock()
+
+	_, exists := roleStore.roles[role.Name]
+	if !exists {
+		return ErrRoleNotFound
+	}
+
+	roleStore.roles[role.Name] = cloneRole(*role)
+	return nil
+}
+
+func (roleStore *InMemoryRoleStore) Delete(ctx context.Context, name string) error {
+
+	roleStore.mu.Lock()
+	defer roleStore.mu.Unlock()
+
+	_, exists := roleStore.roles[name]
+	if !exists {
+		return ErrRoleNotFound
+	}
+
+	delete(roleStore.roles, name)
+	return nil
+}
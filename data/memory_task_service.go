@@ -0,0 +1,326 @@
+package data
+
+// imports
+import (
+	"context";
+	"sort";
+	"sync";
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+	"go.mongodb.org/mongo-driver/bson/primitive";
+)
+
+// in-memory task storage, safe for concurrent use (tests and local development)
+type InMemoryTaskManager struct {
+	mu        sync.RWMutex                                     // guards tasks and history
+	tasks     map[primitive.ObjectID]models.Task               // tasks keyed by id
+	history   map[primitive.ObjectID][]models.TaskRevision     // recorded changes keyed by task id, oldest first
+	users     UserRepository                                   // assignees are looked up here
+}
+
+// create a new empty in-memory task manager, checking assignees against users
+func NewInMemoryTaskManager(users UserRepository) *InMemoryTaskManager {
+	return &InMemoryTaskManager{
+		tasks:   make(map[primitive.ObjectID]models.Task),
+		history: make(map[primitive.ObjectID][]models.TaskRevision),
+		users:   users,
+	}
+}
+
+// add new task to memory
+func (taskServ *InMemoryTaskManager) CreateTask(ctx context.Context, actor models.Actor, task *models.Task) (*models.Task, error) {
+
+	err := validateTask(task)      // same rules as the mongodb implementation
+	if err != nil {
+		return nil, err
+	}
+
+	setTaskOwner(actor, task)
+	err = checkAssignee(ctx, taskServ.users, nil, task)
+	if err != nil {
+		return nil, err
+	}
+
+	taskServ.mu.Lock()
+	defer taskServ.mu.Unlock()
+
+	task.ID = primitive.NewObjectID()       // create a unique id for the new task
+	task.Version = 1                        // first version, bumped on every update
+	taskServ.tasks[task.ID] = *task         // store a copy so callers can't mutate stored state
+	taskServ.appendRevision(newTaskRevision(models.TaskRevision{Action: models.TaskCreated}, actor, nil, task))
+
+	return task, nil       // return the new created task and nil
+}
+
+// move a task to the trash, it stays there until restored or purged
+func (taskServ *InMemoryTaskManager) DeleteTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch) error {
+	_, err := taskServ.modifyTask(ctx, actor, taskID, versions, false, models.TaskRevision{Action: models.TaskDeleted}, moveToTrash(actor))
+	return err
+}
+
+func (taskServ *InMemoryTaskManager) GetAllTasks(ctx context.Context, actor models.Actor, query TaskQuery) (*TaskPage, error) {
+
+	err := query.normalize()      // validate query and apply defaults
+	if err != nil {
+		return nil, err
+	}
+
+	pageCursor, err := decodeTaskCursor(&query)
+	if err != nil {
+		return nil, err
+	}
+
+	taskServ.mu.RLock()
+	defer taskServ.mu.RUnlock()
+
+	matching := make([]models.Task, 0, len(taskServ.tasks))
+	for _, task := range taskServ.tasks {
+		if canViewTask(actor, &task) && matchesTaskQuery(&query, &task) {
+			matching = append(matching, task)
+		}
+	}
+
+	// same ordering as the mongodb sort, ids break ties
+	sort.Slice(matching, func(i, j int) bool {
+		return compareTasks(&query, &matching[i], &matching[j]) < 0
+	})
+
+	// skip everything up to the cursor, then take one extra task to know whether there is a next page
+	pageTasks := []models.Task{}
+	for i := range matching {
+		if len(pageTasks) > query.Limit {
+			break
+		}
+		if afterTaskCursor(&query, pageCursor, &matching[i]) {
+			pageTasks = append(pageTasks, matching[i])
+		}
+	}
+
+	return newTaskPage(&query, pageTasks, int64(len(matching))), nil     // return one page of visible tasks and nil
+}
+
+// tasks in the trash actor could restore, most recently deleted first
+func (taskServ *InMemoryTaskManager) GetDeletedTasks(ctx context.Context, actor models.Actor) ([]models.Task, error) {
+
+	taskServ.mu.RLock()
+	defer taskServ.mu.RUnlock()
+
+	deletedTasks := []models.Task{}
+	for _, task := range taskServ.tasks {
+		if canViewDeletedTask(actor, &task) {
+			deletedTasks = append(deletedTasks, task)
+		}
+	}
+
+	// same ordering as the mongodb sort, ids break ties
+	sort.Slice(deletedTasks, func(i, j int) bool {
+		if !deletedTasks[i].DeletedAt.Equal(*deletedTasks[j].DeletedAt) {
+			return deletedTasks[i].DeletedAt.After(*deletedTasks[j].DeletedAt)
+		}
+		return deletedTasks[i].ID.Hex() < deletedTasks[j].ID.Hex()
+	})
+
+	return deletedTasks, nil
+}
+
+// find one specific task by its id
+func (taskServ *InMemoryTaskManager) GetTaskByID(ctx context.Context, actor models.Actor, taskID string) (*models.Task, error) {
+
+	objID, err := parseTaskID(taskID)      // rejects ids that are not in mongodb's format
+	if err != nil {
+		return nil, err
+	}
+
+	taskServ.mu.RLock()
+	defer taskServ.mu.RUnlock()
+
+	// tasks the actor can't see are reported as missing, so their existence isn't leaked
+	task, exists := taskServ.tasks[objID]
+	if !exists || !canViewTask(actor, &task) {
+		return nil, ErrTaskNotFound
+	}
+
+	return &task, nil    // return a copy of the found task and nil
+}
+
+// find tasks by keyword, best matches first
+func (taskServ *InMemoryTaskManager) SearchTasks(ctx context.Context, actor models.Actor, query string, limit int) ([]TaskSearchResult, error) {
+
+	terms, err := searchTerms(query)      // same tokenizing as the mongodb text index
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err = searchLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	taskServ.mu.RLock()
+	defer taskServ.mu.RUnlock()
+
+	results := []TaskSearchResult{}
+	for _, task := range taskServ.tasks {
+		if !canViewTask(actor, &task) {
+			continue
+		}
+		score := scoreTask(&task, terms)
+		if score > 0 {
+			results = append(results, newTaskSearchResult(task, score, terms))
+		}
+	}
+
+	// best score first, ids break ties like the mongodb sort
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Task.ID.Hex() < results[j].Task.ID.Hex()
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil     // return best matches and nil
+}
+
+// replace an existing task's details, fields left out are cleared
+func (taskServ *InMemoryTaskManager) UpdateTask(ctx context.Context, actor models.Actor, taskID string, taskUpdate *models.Task, versions VersionMatch) (*models.Task, error) {
+	return taskServ.modifyTask(ctx, actor, taskID, versions, false, models.TaskRevision{Action: models.TaskUpdated}, func(current *models.Task) (*models.Task, error) {
+		replacement := *current
+		setEditableFields(&replacement, editableFields(taskUpdate))
+		return &replacement, validateTask(&replacement)
+	})
+}
+
+// apply a merge patch or json patch to an existing task
+func (taskServ *InMemoryTaskManager) PatchTask(ctx context.Context, actor models.Actor, taskID string, patch TaskPatch, versions VersionMatch) (*models.Task, error) {
+	return taskServ.modifyTask(ctx, actor, taskID, versions, false, models.TaskRevision{Action: models.TaskUpdated}, func(current *models.Task) (*models.Task, error) {
+		return applyTaskPatch(current, patch)
+	})
+}
+
+// take a task back out of the trash
+func (taskServ *InMemoryTaskManager) RestoreDeletedTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch) (*models.Task, error) {
+	return taskServ.modifyTask(ctx, actor, taskID, versions, true, models.TaskRevision{Action: models.TaskUndeleted}, takeFromTrash)
+}
+
+// same checks as the mongodb implementation, the lock makes read and write one step
+func (taskServ *InMemoryTaskManager) modifyTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch, deleted bool, entry models.TaskRevision, change func(current *models.Task) (*models.Task, error)) (*models.Task, error) {
+
+	objID, err := parseTaskID(taskID)      // rejects ids that are not in mongodb's format
+	if err != nil {
+		return nil, err
+	}
+
+	taskServ.mu.Lock()
+	defer taskServ.mu.Unlock()
+
+	current, exists := taskServ.tasks[objID]
+	found := canFindTaskToModify(actor, &current, modifyPermission(entry.Action))
+	if deleted {
+		found = canViewDeletedTask(actor, &current)
+	}
+	if !exists || !found {
+		return nil, ErrTaskNotFound
+	}
+
+	if !canModifyTask(actor, &current, modifyPermission(entry.Action)) {
+		return nil, ErrTaskForbidden
+	}
+	if !versions.allows(current.Version) {
+		return nil, ErrTaskVersionMismatch
+	}
+
+	updatedTask, err := change(&current)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAssignee(ctx, taskServ.users, &current, updatedTask)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedTask.Version = current.Version + 1
+	taskServ.tasks[objID] = *updatedTask
+	taskServ.appendRevision(newTaskRevision(entry, actor, &current, updatedTask))
+	return updatedTask, nil  // return the updated task and nil
+}
+
+// record a change, callers hold the write lock
+func (taskServ *InMemoryTaskManager) appendRevision(revision *models.TaskRevision) {
+	taskServ.history[revision.TaskID] = append(taskServ.history[revision.TaskID], *revision)
+}
+
+// every recorded change of a task visible to actor, oldest first
+func (taskServ *InMemoryTaskManager) GetTaskHistory(ctx context.Context, actor models.Actor, taskID string) ([]models.TaskRevision, error) {
+
+	task, err := taskServ.GetTaskByID(ctx, actor, taskID)      // same visibility rules as reading the task
+	if err != nil {
+		return nil, err
+	}
+
+	taskServ.mu.RLock()
+	defer taskServ.mu.RUnlock()
+
+	return append([]models.TaskRevision{}, taskServ.history[task.ID]...), nil      // copy so callers can't mutate stored history
+}
+
+// set a task back to how it was at an earlier revision, recorded as a new revision
+func (taskServ *InMemoryTaskManager) RestoreTaskRevision(ctx context.Context, actor models.Actor, taskID string, revision int64, versions VersionMatch) (*models.Task, error) {
+
+	objID, err := parseTaskID(taskID)      // rejects ids that are not in mongodb's format
+	if err != nil {
+		return nil, err
+	}
+
+	var target *models.TaskRevision
+	taskServ.mu.RLock()
+
+	// unknown tasks and tasks the actor can't change are reported before anything about their revisions
+	task, exists := taskServ.tasks[objID]
+	if !exists || !canFindTaskToModify(actor, &task, models.PermTasksUpdateAny) {
+		taskServ.mu.RUnlock()
+		return nil, ErrTaskNotFound
+	}
+
+	for i := range taskServ.history[objID] {
+		if taskServ.history[objID][i].Revision == revision {
+			found := taskServ.history[objID][i]
+			target = &found
+		}
+	}
+	taskServ.mu.RUnlock()
+
+	if target == nil {
+		return nil, ErrTaskRevisionNotFound
+	}
+
+	// permissions are checked on the current task, like any other update
+	return taskServ.modifyTask(ctx, actor, taskID, versions, false, models.TaskRevision{Action: models.TaskRestored, RestoredFrom: revision}, restoreTo(target))
+}
+
+// remove tasks that went to the trash before deletedBefore for good, together with their history
+func (taskServ *InMemoryTaskManager) PurgeDeletedTasks(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	taskServ.mu.Lock()
+	defer taskServ.mu.Unlock()
+
+	var purged int64
+	for objID, task := range taskServ.tasks {
+		if task.DeletedAt == nil || !task.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+		delete(taskServ.tasks, objID)
+		delete(taskServ.history, objID)      // every entry holds a copy of the task
+		purged++
+	}
+
+	return purged, nil
+}
+
+// nothing to release, present so both implementations can be closed the same way
+func (taskServ *InMemoryTaskManager) Close(ctx context.Context) error {
+	return nil
+}
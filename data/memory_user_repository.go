@@ -0,0 +1,102 @@
+package data
+
+// imports
+import (
+	"context";
+	"sync";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+	"go.mongodb.org/mongo-driver/bson/primitive";
+)
+
+// in-memory user storage, safe for concurrent use (tests and local development)
+type InMemoryUserRepository struct {
+	mu        sync.RWMutex                 // guards users
+	users     map[string]models.User       // users keyed by id
+}
+
+// create a new empty in-memory user repository
+func NewInMemoryUserRepository() *InMemoryUserRepository {
+	return &InMemoryUserRepository{users: make(map[string]models.User)}
+}
+
+func (userRepo *InMemoryUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+
+	userRepo.mu.RLock()
+	defer userRepo.mu.RUnlock()
+
+	for _, user := range userRepo.users {
+		if user.Username == username {
+			return &user, nil      // return a copy of the stored user
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+func (userRepo *InMemoryUserRepository) FindByID(ctx context.Context, userID string) (*models.User, error) {
+
+	userRepo.mu.RLock()
+	defer userRepo.mu.RUnlock()
+
+	user, exists := userRepo.users[userID]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	return &user, nil      // return a copy of the stored user
+}
+
+func (userRepo *InMemoryUserRepository) Count(ctx context.Context) (int64, error) {
+
+	userRepo.mu.RLock()
+	defer userRepo.mu.RUnlock()
+
+	return int64(len(userRepo.users)), nil
+}
+
+func (userRepo *InMemoryUserRepository) CountByRole(ctx context.Context, role string) (int64, error) {
+
+	userRepo.mu.RLock()
+	defer userRepo.mu.RUnlock()
+
+	var count int64
+	for _, user := range userRepo.users {
+		if user.Role == role {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (userRepo *InMemoryUserRepository) Insert(ctx context.Context, user *models.User) error {
+
+	userRepo.mu.Lock()
+	defer userRepo.mu.Unlock()
+
+	// usernames must be unique, same as the mongodb unique index
+	for _, existing := range userRepo.users {
+		if existing.Username == user.Username {
+			return ErrUsernameTaken
+		}
+	}
+
+	user.ID = primitive.NewObjectID().Hex()     // same id format mongodb would generate
+	userRepo.users[user.ID] = *user
+	return nil
+}
+
+func (userRepo *InMemoryUserRepository) SetRole(ctx context.Context, userID string, role string) error {
+
+	userRepo.mu.Lock()
+	defer userRepo.mu.Unlock()
+
+	user, exists := userRepo.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	user.Role = role
+	userRepo.users[userID] = user
+	return nil
+}
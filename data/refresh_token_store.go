@@ -0,0 +1,140 @@
+package data
+
+// imports
+import (
+	"context";
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+	"go.mongodb.org/mongo-driver/bson";
+	"go.mongodb.org/mongo-driver/mongo";
+	"go.mongodb.org/mongo-driver/mongo/options";
+)
+
+var ErrRefreshTokenNotFound = NotFoundError("refresh_token_not_found", "refresh token not found")
+
+// server-side storage for refresh tokens
+type RefreshTokenStore interface {
+	Save(ctx context.Context, token *models.RefreshToken) error                    // store a newly issued token
+	Find(ctx context.Context, tokenID string) (*models.RefreshToken, error)        // find token by hash or return ErrRefreshTokenNotFound
+	MarkUsed(ctx context.Context, tokenID string) (bool, error)                    // atomically flag an unused, unrevoked token as used, false if it already was
+	RevokeFamily(ctx context.Context, familyID string) error                       // revoke every token rotated from the same login
+	RevokeUser(ctx context.Context, userID string) error                           // revoke every token issued to a user
+}
+
+type MongoDBRefreshTokenStore struct {
+	client           *mongo.Client      // connection to mongodb
+	database         string             // which database to use
+	collection       string             // which collection holds refresh tokens
+	timeout          time.Duration      // per-query deadline
+	indexes          []string           // names of the indexes created at startup
+}
+
+// create a refresh token store on an existing mongodb connection
+func NewMongoDBRefreshTokenStore(ctx context.Context, client *mongo.Client, db, colln string, timeout time.Duration) (*MongoDBRefreshTokenStore, error) {
+
+	tokenStore := &MongoDBRefreshTokenStore{
+		client:     client,
+		database:   db,
+		collection: colln,
+		timeout:    timeout,
+	}
+
+	names, err := tokenStore.collectionRef().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),      // let mongodb drop expired tokens
+		},
+		{
+			Keys: bson.D{{Key: "family_id", Value: 1}},               // family revocation lookups
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},                 // user revocation lookups
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	tokenStore.indexes = names
+
+	return tokenStore, nil
+}
+
+func (tokenStore *MongoDBRefreshTokenStore) collectionRef() *mongo.Collection {
+	return tokenStore.client.Database(tokenStore.database).Collection(tokenStore.collection)
+}
+
+// fail if an index created at startup has been dropped since
+func (tokenStore *MongoDBRefreshTokenStore) CheckIndexes(ctx context.Context) error {
+	return checkIndexes(ctx, tokenStore.collectionRef(), tokenStore.indexes)
+}
+
+func (tokenStore *MongoDBRefreshTokenStore) Save(ctx context.Context, token *models.RefreshToken) error {
+
+	contx, cancel := context.WithTimeout(ctx, tokenStore.timeout)      // set timeout
+	defer cancel()
+
+	_, err := tokenStore.collectionRef().InsertOne(contx, token)
+	return err
+}
+
+func (tokenStore *MongoDBRefreshTokenStore) Find(ctx context.Context, tokenID string) (*models.RefreshToken, error) {
+
+	var token models.RefreshToken
+
+	contx, cancel := context.WithTimeout(ctx, tokenStore.timeout)      // set timeout
+	defer cancel()
+
+	err := tokenStore.collectionRef().FindOne(contx, bson.M{"_id": tokenID}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (tokenStore *MongoDBRefreshTokenStore) MarkUsed(ctx context.Context, tokenID string) (bool, error) {
+
+	contx, cancel := context.WithTimeout(ctx, tokenStore.timeout)      // set timeout
+	defer cancel()
+
+	// single conditional update, so two concurrent refreshes can't both win
+	result, err := tokenStore.collectionRef().UpdateOne(
+		contx,
+		bson.M{"_id": tokenID, "used": false, "revoked": false},
+		bson.M{"$set": bson.M{"used": true}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (tokenStore *MongoDBRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+
+	contx, cancel := context.WithTimeout(ctx, tokenStore.timeout)      // set timeout
+	defer cancel()
+
+	_, err := tokenStore.collectionRef().UpdateMany(
+		contx,
+		bson.M{"family_id": familyID},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	return err
+}
+
+func (tokenStore *MongoDBRefreshTokenStore) RevokeUser(ctx context.Context, userID string) error {
+
+	contx, cancel := context.WithTimeout(ctx, tokenStore.timeout)      // set timeout
+	defer cancel()
+
+	_, err := tokenStore.collectionRef().UpdateMany(
+		contx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	return err
+}
@@ -0,0 +1,138 @@
+package data
+
+// imports
+import (
+	"context";
+	"time";
+	"go.mongodb.org/mongo-driver/bson";
+	"go.mongodb.org/mongo-driver/mongo";
+	"go.mongodb.org/mongo-driver/mongo/options";
+)
+
+// how often in-memory revocation entries are checked for expiry
+const revocationGCInterval = time.Minute
+
+// server-side list of access tokens that must be rejected before they expire
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error                    // reject a single token (by jti) until expiresAt (its exp plus clock skew)
+	RevokeUser(ctx context.Context, userID string, revokedAt, expiresAt time.Time) error           // reject every token issued to user up to revokedAt
+	IsRevoked(ctx context.Context, tokenID, userID string, issuedAt time.Time) (bool, error)      // whether a token was revoked directly or through its user
+}
+
+// a revoked token is rejected if it was issued before the second the user was revoked in.
+// jwt timestamps only have second precision, so tokens issued in that same second are let through,
+// otherwise logging in again right after a revocation or role change would fail until the next second
+func issuedBeforeRevocation(issuedAt, revokedAt time.Time) bool {
+	return issuedAt.Unix() < revokedAt.Unix()
+}
+
+// revocation entry as stored in mongodb
+type revocationRecord struct {
+	ID           string      `bson:"_id"`                     // "token:<jti>" or "user:<user id>"
+	RevokedAt    time.Time   `bson:"revoked_at"`              // when the revocation happened
+	ExpiresAt    time.Time   `bson:"expires_at"`              // after this every affected token has expired anyway, clock skew included
+}
+
+type MongoDBRevocationStore struct {
+	client           *mongo.Client      // connection to mongodb
+	database         string             // which database to use
+	collection       string             // which collection holds revocations
+	timeout          time.Duration      // per-query deadline
+	indexes          []string           // names of the indexes created at startup
+}
+
+// create a revocation store on an existing mongodb connection
+func NewMongoDBRevocationStore(ctx context.Context, client *mongo.Client, db, colln string, timeout time.Duration) (*MongoDBRevocationStore, error) {
+
+	revocations := &MongoDBRevocationStore{
+		client:     client,
+		database:   db,
+		collection: colln,
+		timeout:    timeout,
+	}
+
+	// mongodb garbage-collects entries once every token they cover has expired
+	name, err := revocations.collectionRef().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	revocations.indexes = []string{name}
+
+	return revocations, nil
+}
+
+func (revocations *MongoDBRevocationStore) collectionRef() *mongo.Collection {
+	return revocations.client.Database(revocations.database).Collection(revocations.collection)
+}
+
+// fail if an index created at startup has been dropped since
+func (revocations *MongoDBRevocationStore) CheckIndexes(ctx context.Context) error {
+	return checkIndexes(ctx, revocations.collectionRef(), revocations.indexes)
+}
+
+// insert or replace a revocation entry
+func (revocations *MongoDBRevocationStore) upsert(ctx context.Context, record revocationRecord) error {
+
+	contx, cancel := context.WithTimeout(ctx, revocations.timeout)      // set timeout
+	defer cancel()
+
+	_, err := revocations.collectionRef().ReplaceOne(
+		contx,
+		bson.M{"_id": record.ID},
+		record,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (revocations *MongoDBRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return revocations.upsert(ctx, revocationRecord{
+		ID:        "token:" + tokenID,
+		RevokedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (revocations *MongoDBRevocationStore) RevokeUser(ctx context.Context, userID string, revokedAt, expiresAt time.Time) error {
+	return revocations.upsert(ctx, revocationRecord{
+		ID:        "user:" + userID,
+		RevokedAt: revokedAt.Truncate(time.Second),      // stored with the precision it is compared at
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (revocations *MongoDBRevocationStore) IsRevoked(ctx context.Context, tokenID, userID string, issuedAt time.Time) (bool, error) {
+
+	contx, cancel := context.WithTimeout(ctx, revocations.timeout)      // set timeout
+	defer cancel()
+
+	cursor, err := revocations.collectionRef().Find(contx, bson.M{
+		"_id": bson.M{"$in": bson.A{"token:" + tokenID, "user:" + userID}},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	defer cursor.Close(contx)
+
+	var records []revocationRecord
+	err = cursor.All(contx, &records)
+	if err != nil {
+		return false, err
+	}
+
+	for _, record := range records {
+		// the ttl monitor only runs once a minute, so skip entries that already expired
+		if time.Now().After(record.ExpiresAt) {
+			continue
+		}
+		if record.ID == "token:" + tokenID || issuedBeforeRevocation(issuedAt, record.RevokedAt) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,362 @@
+package data
+
+// imports
+import (
+	"context";
+	"fmt";
+	"regexp";
+	"slices";
+	"strings";
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/metrics";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/tracing";
+	"go.mongodb.org/mongo-driver/bson/primitive";
+)
+
+var (
+	ErrBuiltInRole  = ForbiddenError("built_in_role", "built-in roles can not be changed or deleted")
+	ErrRoleInUse    = ConflictError("role_in_use", "role is still assigned to users, give them another role first")
+	ErrOwnRole      = ForbiddenError("own_role", "you can not change your own role")
+	ErrLastAdmin    = ConflictError("last_admin", "the last admin can not be given another role")
+)
+
+// lowercase letters, digits, "_" and "-", starting with a letter
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// roles that exist without being stored, nobody can change them through the api
+var builtInRoles = []models.Role{
+	{
+		Name:        models.RoleAdmin,
+		Description: "full access to every task, user and role",
+		Permissions: models.AllPermissions,
+		BuiltIn:     true,
+	},
+	{
+		Name:        models.RoleUser,
+		Description: "manages the tasks they own, the default for new users",
+		Permissions: []string{models.PermTasksRead, models.PermTasksCreate, models.PermTasksUpdate, models.PermTasksDelete},
+		BuiltIn:     true,
+	},
+}
+
+func builtInRole(name string) (models.Role, bool) {
+	for _, role := range builtInRoles {
+		if role.Name == name {
+			return role, true
+		}
+	}
+	return models.Role{}, false
+}
+
+// nobody can hand out permissions they don't hold themselves, so holding roles:manage or users:promote
+// never lets anyone raise their own or someone else's access above their own
+func requireHeld(actor models.Actor, field string, permissions []string) error {
+	var missing []string
+	for _, permission := range permissions {
+		if !actor.Can(permission) {
+			missing = append(missing, permission)
+		}
+	}
+	if len(missing) > 0 {
+		return ForbiddenError("permission_not_held", "you can only hand out permissions you hold", FieldError{Field: field, Code: "not_held", Message: "you don't hold: " + strings.Join(missing, ", ")})
+	}
+	return nil
+}
+
+// manages custom roles and which role users have, and turns roles into permissions for the auth middleware
+type RoleService struct {
+	roles          RoleStore              // where custom roles are persisted
+	users          UserRepository         // users roles are assigned to
+	sessions       *UserService           // revokes the sessions of users whose role changed
+}
+
+// creates new RoleService instance on top of any role and user storage
+func NewRoleService(roles RoleStore, users UserRepository, sessions *UserService) *RoleService {
+	return &RoleService{roles: roles, users: users, sessions: sessions}
+}
+
+// permissions of a built-in or stored role, false if there is no such role
+func (roleServ *RoleService) lookupPermissions(ctx context.Context, name string) ([]string, bool, error) {
+
+	role, ok := builtInRole(name)
+	if ok {
+		return role.Permissions, true, nil      // the common case, no storage round trip
+	}
+
+	stored, err := roleServ.roles.Find(ctx, name)
+	if err == ErrRoleNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, InternalError(fmt.Errorf("failed to load role %s: %w", name, err))
+	}
+
+	return stored.Permissions, true, nil
+}
+
+// permissions granted by a role, none for a role that doesn't exist (anymore)
+func (roleServ *RoleService) Permissions(ctx context.Context, name string) (permissions []string, err error) {
+	ctx, span := tracing.Start(ctx, "RoleService.Permissions")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("role_service", "Permissions", time.Now(), &err)
+
+	permissions, _, err = roleServ.lookupPermissions(ctx, name)      // none for e.g. a role deleted while the user still had a token for it
+	return permissions, err
+}
+
+// built-in roles followed by custom roles sorted by name
+func (roleServ *RoleService) ListRoles(ctx context.Context) (roles []models.Role, err error) {
+	ctx, span := tracing.Start(ctx, "RoleService.ListRoles")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("role_service", "ListRoles", time.Now(), &err)
+
+	stored, err := roleServ.roles.List(ctx)
+	if err != nil {
+		return nil, InternalError(fmt.Errorf("failed to list roles: %w", err))
+	}
+
+	return append(slices.Clone(builtInRoles), stored...), nil
+}
+
+func (roleServ *RoleService) GetRole(ctx context.Context, name string) (role *models.Role, err error) {
+	ctx, span := tracing.Start(ctx, "RoleService.GetRole")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("role_service", "GetRole", time.Now(), &err)
+
+	builtIn, ok := builtInRole(name)
+	if ok {
+		return &builtIn, nil
+	}
+
+	role, err = roleServ.roles.Find(ctx, name)
+	if err == ErrRoleNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, InternalError(fmt.Errorf("failed to load role %s: %w", name, err))
+	}
+
+	return role, nil
+}
+
+// create a custom role, actor must hold every permission it grants
+func (roleServ *RoleService) CreateRole(ctx context.Context, actor models.Actor, role *models.Role) (err error) {
+	ctx, span := tracing.Start(ctx, "RoleService.CreateRole")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("role_service", "CreateRole", time.Now(), &err)
+
+	err = validateRole(role)
+	if err != nil {
+		return err
+	}
+	err = requireHeld(actor, "permissions", role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	_, ok := builtInRole(role.Name)
+	if ok {
+		return ErrRoleExists
+	}
+
+	role.BuiltIn = false
+	err = roleServ.roles.Insert(ctx, role)
+	if err == ErrRoleExists {
+		return err
+	}
+	if err != nil {
+		return InternalError(fmt.Errorf("failed to create role %s: %w", role.Name, err))
+	}
+
+	return nil
+}
+
+// replace the description and permissions of a custom role, users with the role get the new permissions on their next request.
+// actor must hold every permission the role grants before and after, and can't change the role they have
+func (roleServ *RoleService) UpdateRole(ctx context.Context, actor models.Actor, name string, role *models.Role) (err error) {
+	ctx, span := tracing.Start(ctx, "RoleService.UpdateRole")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("role_service", "UpdateRole", time.Now(), &err)
+
+	err = roleServ.checkManageable(ctx, actor, name)
+	if err != nil {
+		return err
+	}
+
+	role.Name = name      // renaming would leave users pointing at a role that no longer exists
+	err = validateRole(role)
+	if err != nil {
+		return err
+	}
+	err = requireHeld(actor, "permissions", role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	role.BuiltIn = false
+	err = roleServ.roles.Replace(ctx, role)
+	if err == ErrRoleNotFound {
+		return err
+	}
+	if err != nil {
+		return InternalError(fmt.Errorf("failed to update role %s: %w", name, err))
+	}
+
+	return nil
+}
+
+// delete a custom role nobody has anymore, same rules as changing it
+func (roleServ *RoleService) DeleteRole(ctx context.Context, actor models.Actor, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "RoleService.DeleteRole")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("role_service", "DeleteRole", time.Now(), &err)
+
+	err = roleServ.checkManageable(ctx, actor, name)
+	if err != nil {
+		return err
+	}
+
+	// a user assigned concurrently ends up with no permissions, which is safe
+	count, err := roleServ.users.CountByRole(ctx, name)
+	if err != nil {
+		return InternalError(fmt.Errorf("failed to check users with role %s: %w", name, err))
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+
+	err = roleServ.roles.Delete(ctx, name)
+	if err == ErrRoleNotFound {
+		return err
+	}
+	if err != nil {
+		return InternalError(fmt.Errorf("failed to delete role %s: %w", name, err))
+	}
+
+	return nil
+}
+
+// give a user a built-in or custom role and revoke their sessions, so the new role applies right away.
+// actor can't change their own role, and must hold every permission of both the user's current and new role
+func (roleServ *RoleService) AssignRole(ctx context.Context, actor models.Actor, userID, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "RoleService.AssignRole")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("role_service", "AssignRole", time.Now(), &err)
+
+	_, err = primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+	if userID == actor.UserID {
+		return ErrOwnRole
+	}
+
+	permissions, exists, err := roleServ.lookupPermissions(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ValidationError("unknown_role", "role does not exist", FieldError{Field: "role", Code: "unknown", Message: "no role named " + name})
+	}
+	err = requireHeld(actor, "role", permissions)
+	if err != nil {
+		return err
+	}
+
+	user, err := roleServ.users.FindByID(ctx, userID)
+	if err == ErrUserNotFound {
+		return err
+	}
+	if err != nil {
+		return InternalError(err)
+	}
+
+	// taking a role away is handing out access too, nobody can demote someone with more access than they have
+	current, _, err := roleServ.lookupPermissions(ctx, user.Role)
+	if err != nil {
+		return err
+	}
+	err = requireHeld(actor, "id", current)
+	if err != nil {
+		return err
+	}
+
+	// someone has to be left to manage everything
+	if user.Role == models.RoleAdmin && name != models.RoleAdmin {
+		admins, err := roleServ.users.CountByRole(ctx, models.RoleAdmin)
+		if err != nil {
+			return InternalError(fmt.Errorf("failed to count admins: %w", err))
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	err = roleServ.users.SetRole(ctx, userID, name)
+	if err == ErrUserNotFound {
+		return err
+	}
+	if err != nil {
+		return InternalError(fmt.Errorf("failed to assign role %s to user %s: %w", name, userID, err))
+	}
+
+	// tokens name the role they were issued with, so the old ones would keep the old role's access until they expire
+	return roleServ.sessions.RevokeAllSessions(ctx, userID)
+}
+
+// custom role actor may change or delete: not their own, and granting nothing they don't hold
+func (roleServ *RoleService) checkManageable(ctx context.Context, actor models.Actor, name string) error {
+
+	_, ok := builtInRole(name)
+	if ok {
+		return ErrBuiltInRole
+	}
+	if name == actor.Role {
+		return ErrOwnRole
+	}
+
+	stored, err := roleServ.roles.Find(ctx, name)
+	if err == ErrRoleNotFound {
+		return err
+	}
+	if err != nil {
+		return InternalError(fmt.Errorf("failed to load role %s: %w", name, err))
+	}
+
+	return requireHeld(actor, "name", stored.Permissions)
+}
+
+// check name and permissions, and put the permissions in the order they are listed in models.AllPermissions
+func validateRole(role *models.Role) error {
+
+	var fields []FieldError
+	if !roleNamePattern.MatchString(role.Name) {
+		fields = append(fields, FieldError{Field: "name", Code: "invalid", Message: "must be 1-32 lowercase letters, digits, '_' or '-', starting with a letter"})
+	}
+
+	var unknown []string
+	for _, permission := range role.Permissions {
+		if !slices.Contains(models.AllPermissions, permission) {
+			unknown = append(unknown, permission)
+		}
+	}
+	if len(unknown) > 0 {
+		fields = append(fields, FieldError{Field: "permissions", Code: "unknown", Message: "unknown permissions: " + strings.Join(unknown, ", ")})
+	}
+
+	if len(fields) > 0 {
+		return ValidationError("invalid_role", "role is invalid", fields...)
+	}
+
+	// drops duplicates as well
+	permissions := []string{}
+	for _, permission := range models.AllPermissions {
+		if slices.Contains(role.Permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	role.Permissions = permissions
+
+	return nil
+}
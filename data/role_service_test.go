@@ -0,0 +1,165 @@
+package data
+
+// imports
+import (
+	"context";
+	"errors";
+	"testing";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+// role manager that can read and create tasks on top of managing roles, but not promote or see others' tasks
+func newRoleManager(t *testing.T, services *testServices) *models.User {
+	t.Helper()
+	err := services.roles.Insert(context.Background(), &models.Role{
+		Name:        "role_manager",
+		Permissions: []string{models.PermTasksRead, models.PermTasksCreate, models.PermUsersPromote, models.PermRolesManage},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return services.addUser(t, "manager", "role_manager")
+}
+
+func TestCreateRoleRequiresHeldPermissions(t *testing.T) {
+
+	ctx := context.Background()
+	services := newTestServices(t)
+	actor := services.actor(t, newRoleManager(t, services))
+
+	err := services.roleService.CreateRole(ctx, actor, &models.Role{Name: "reader_any", Permissions: []string{models.PermTasksRead, models.PermTasksReadAny}})
+	if !errors.Is(err, ErrForbidden) || errorCode(err) != "permission_not_held" {
+		t.Fatalf("creating a role with a permission not held: got %v, want permission_not_held", err)
+	}
+	fields := err.(*Error).Fields
+	if len(fields) != 1 || fields[0].Field != "permissions" {
+		t.Errorf("field errors = %+v, want one for permissions", fields)
+	}
+	_, err = services.roles.Find(ctx, "reader_any")
+	if err != ErrRoleNotFound {
+		t.Errorf("refused role was stored: %v", err)
+	}
+
+	// ":any" implies the plain permission, but never the other way round
+	err = services.roleService.CreateRole(ctx, actor, &models.Role{Name: "reader", Permissions: []string{models.PermTasksRead}})
+	if err != nil {
+		t.Fatalf("creating a role with held permissions: %v", err)
+	}
+}
+
+func TestUpdateAndDeleteRoleGuards(t *testing.T) {
+
+	ctx := context.Background()
+	services := newTestServices(t)
+	actor := services.actor(t, newRoleManager(t, services))
+
+	err := services.roleService.UpdateRole(ctx, actor, "role_manager", &models.Role{Permissions: models.AllPermissions})
+	if !errors.Is(err, ErrOwnRole) {
+		t.Errorf("changing your own role: got %v, want %v", err, ErrOwnRole)
+	}
+
+	err = services.roleService.UpdateRole(ctx, actor, models.RoleUser, &models.Role{Permissions: []string{models.PermTasksRead}})
+	if !errors.Is(err, ErrBuiltInRole) {
+		t.Errorf("changing a built-in role: got %v, want %v", err, ErrBuiltInRole)
+	}
+
+	err = services.roles.Insert(ctx, &models.Role{Name: "reader", Permissions: []string{models.PermTasksRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = services.roleService.UpdateRole(ctx, actor, "reader", &models.Role{Permissions: []string{models.PermTasksRead, models.PermTasksDeleteAny}})
+	if errorCode(err) != "permission_not_held" {
+		t.Errorf("adding a permission not held: got %v, want permission_not_held", err)
+	}
+
+	// a role granting more than the actor holds can't be changed or deleted by them either
+	err = services.roles.Insert(ctx, &models.Role{Name: "auditor", Permissions: []string{models.PermTasksReadAny}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = services.roleService.UpdateRole(ctx, actor, "auditor", &models.Role{Permissions: []string{models.PermTasksRead}})
+	if errorCode(err) != "permission_not_held" {
+		t.Errorf("changing a role granting more than held: got %v, want permission_not_held", err)
+	}
+	err = services.roleService.DeleteRole(ctx, actor, "auditor")
+	if errorCode(err) != "permission_not_held" {
+		t.Errorf("deleting a role granting more than held: got %v, want permission_not_held", err)
+	}
+
+	err = services.roleService.DeleteRole(ctx, actor, "role_manager")
+	if !errors.Is(err, ErrOwnRole) {
+		t.Errorf("deleting your own role: got %v, want %v", err, ErrOwnRole)
+	}
+	err = services.roleService.DeleteRole(ctx, actor, "reader")
+	if err != nil {
+		t.Errorf("deleting a role within held permissions: %v", err)
+	}
+}
+
+func TestAssignRoleGuards(t *testing.T) {
+
+	ctx := context.Background()
+	services := newTestServices(t)
+	manager := newRoleManager(t, services)
+	actor := services.actor(t, manager)
+	user := services.addUser(t, "user", models.RoleUser)
+	admin := services.addUser(t, "admin", models.RoleAdmin)
+
+	err := services.roleService.AssignRole(ctx, actor, manager.ID, models.RoleAdmin)
+	if !errors.Is(err, ErrOwnRole) {
+		t.Errorf("assigning yourself a role: got %v, want %v", err, ErrOwnRole)
+	}
+
+	err = services.roleService.AssignRole(ctx, actor, user.ID, models.RoleAdmin)
+	if errorCode(err) != "permission_not_held" {
+		t.Errorf("assigning a role granting more than held: got %v, want permission_not_held", err)
+	}
+
+	// the admin has more than the manager, so the manager can't take it away either
+	err = services.roleService.AssignRole(ctx, actor, admin.ID, "role_manager")
+	if errorCode(err) != "permission_not_held" {
+		t.Errorf("demoting someone with more access: got %v, want permission_not_held", err)
+	}
+	if role := services.roleOf(t, admin); role != models.RoleAdmin {
+		t.Errorf("refused demotion changed the role to %q", role)
+	}
+
+	err = services.roleService.AssignRole(ctx, actor, user.ID, "no_such_role")
+	if errorCode(err) != "unknown_role" {
+		t.Errorf("assigning a role that doesn't exist: got %v, want unknown_role", err)
+	}
+}
+
+func TestAssignRoleKeepsLastAdmin(t *testing.T) {
+
+	ctx := context.Background()
+	services := newTestServices(t)
+	admin := services.addUser(t, "admin", models.RoleAdmin)
+	other := services.addUser(t, "other", models.RoleAdmin)
+
+	// with two admins one can demote the other, and that ends the demoted admin's sessions
+	err := services.roleService.AssignRole(ctx, services.actor(t, admin), other.ID, models.RoleUser)
+	if err != nil {
+		t.Fatalf("demoting one of two admins: %v", err)
+	}
+	if role := services.roleOf(t, other); role != models.RoleUser {
+		t.Errorf("role after demotion = %q, want %q", role, models.RoleUser)
+	}
+	if !services.sessionsRevoked(t, other) {
+		t.Error("tokens issued before the demotion still work")
+	}
+
+	// a custom role holding every permission can act for admins, but not remove the last one
+	err = services.roles.Insert(ctx, &models.Role{Name: "superuser", Permissions: models.AllPermissions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	superuser := services.addUser(t, "superuser", "superuser")
+	err = services.roleService.AssignRole(ctx, services.actor(t, superuser), admin.ID, models.RoleUser)
+	if !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("demoting the last admin: got %v, want %v", err, ErrLastAdmin)
+	}
+	if role := services.roleOf(t, admin); role != models.RoleAdmin {
+		t.Errorf("last admin's role changed to %q", role)
+	}
+}
@@ -0,0 +1,131 @@
+package data
+
+// imports
+import (
+	"context";
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+	"go.mongodb.org/mongo-driver/bson";
+	"go.mongodb.org/mongo-driver/mongo";
+	"go.mongodb.org/mongo-driver/mongo/options";
+)
+
+var (
+	ErrRoleNotFound  = NotFoundError("role_not_found", "role not found")                          // no role with this name
+	ErrRoleExists    = ConflictError("role_exists", "a role with this name already exists")      // another role already has this name
+)
+
+// storage for custom roles, the built-in ones live in code
+type RoleStore interface {
+	List(ctx context.Context) ([]models.Role, error)                       // every stored role, sorted by name
+	Find(ctx context.Context, name string) (*models.Role, error)          // find role by name or return ErrRoleNotFound
+	Insert(ctx context.Context, role *models.Role) error                  // save a new role or return ErrRoleExists
+	Replace(ctx context.Context, role *models.Role) error                 // overwrite an existing role or return ErrRoleNotFound
+	Delete(ctx context.Context, name string) error                        // remove role or return ErrRoleNotFound
+}
+
+type MongoDBRoleStore struct {
+	client           *mongo.Client      // connection to mongodb
+	database         string             // which database to use
+	collection       string             // which collection holds roles
+	timeout          time.Duration      // per-query deadline
+}
+
+// create a role store on an existing mongodb connection, roles are keyed by name so no indexes are needed
+func NewMongoDBRoleStore(client *mongo.Client, db, colln string, timeout time.Duration) *MongoDBRoleStore {
+	return &MongoDBRoleStore{
+		client:     client,
+		database:   db,
+		collection: colln,
+		timeout:    timeout,
+	}
+}
+
+func (roleStore *MongoDBRoleStore) collectionRef() *mongo.Collection {
+	return roleStore.client.Database(roleStore.database).Collection(roleStore.collection)
+}
+
+func (roleStore *MongoDBRoleStore) List(ctx context.Context) ([]models.Role, error) {
+
+	contx, cancel := context.WithTimeout(ctx, roleStore.timeout)      // set timeout
+	defer cancel()
+
+	cursor, err := roleStore.collectionRef().Find(contx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(contx)
+
+	roles := []models.Role{}
+	err = cursor.All(contx, &roles)
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (roleStore *MongoDBRoleStore) Find(ctx context.Context, name string) (*models.Role, error) {
+
+	var role models.Role
+
+	contx, cancel := context.WithTimeout(ctx, roleStore.timeout)      // set timeout
+	defer cancel()
+
+	err := roleStore.collectionRef().FindOne(contx, bson.M{"_id": name}).Decode(&role)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (roleStore *MongoDBRoleStore) Insert(ctx context.Context, role *models.Role) error {
+
+	contx, cancel := context.WithTimeout(ctx, roleStore.timeout)      // set timeout
+	defer cancel()
+
+	_, err := roleStore.collectionRef().InsertOne(contx, role)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrRoleExists      // the name is the _id, so two creates racing each other can't both win
+	}
+
+	return err
+}
+
+func (roleStore *MongoDBRoleStore) Replace(ctx context.Context, role *models.Role) error {
+
+	contx, cancel := context.WithTimeout(ctx, roleStore.timeout)      // set timeout
+	defer cancel()
+
+	result, err := roleStore.collectionRef().ReplaceOne(contx, bson.M{"_id": role.Name}, role)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRoleNotFound
+	}
+
+	return nil
+}
+
+func (roleStore *MongoDBRoleStore) Delete(ctx context.Context, name string) error {
+
+	contx, cancel := context.WithTimeout(ctx, roleStore.timeout)      // set timeout
+	defer cancel()
+
+	result, err := roleStore.collectionRef().DeleteOne(contx, bson.M{"_id": name})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrRoleNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package data
+
+// imports
+import (
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+var ErrTaskRevisionNotFound = NotFoundError("task_revision_not_found", "no revision with this number for the task")
+
+// field-level differences between two states of a task, before is nil for new tasks
+func diffTasks(before, after *models.Task) []models.FieldChange {
+
+	var from taskFields
+	if before != nil {
+		from = editableFields(before)
+	}
+	to := editableFields(after)
+
+	changes := []models.FieldChange{}
+	add := func(field string, fromValue, toValue any, changed bool) {
+		if !changed {
+			return
+		}
+		if before == nil {
+			fromValue = nil
+		}
+		changes = append(changes, models.FieldChange{Field: field, From: fromValue, To: toValue})
+	}
+
+	add("title", from.Title, to.Title, before == nil || from.Title != to.Title)
+	add("description", from.Description, to.Description, before == nil || from.Description != to.Description)
+	add("due_date", from.DueDate, to.DueDate, before == nil || !from.DueDate.Equal(to.DueDate))
+	add("status", from.Status, to.Status, before == nil || from.Status != to.Status)
+	add("assigned_to", from.AssignedTo, to.AssignedTo, before == nil || from.AssignedTo != to.AssignedTo)
+
+	// moving to and out of the trash
+	var deletedFrom *time.Time
+	if before != nil {
+		deletedFrom = before.DeletedAt
+	}
+	deletedTo := after.DeletedAt
+	if (deletedFrom == nil) != (deletedTo == nil) {
+		changes = append(changes, models.FieldChange{Field: "deleted_at", From: deletedFrom, To: deletedTo})
+	}
+
+	return changes
+}
+
+// history entry for a change made by actor, entry carries the action (and what a restore went back to)
+func newTaskRevision(entry models.TaskRevision, actor models.Actor, before, after *models.Task) *models.TaskRevision {
+
+	entry.ActorID = actor.UserID
+	entry.At = time.Now().UTC()
+	entry.Changes = diffTasks(before, after)
+	entry.TaskID = after.ID
+	entry.Revision = after.Version
+	entry.Task = *after
+
+	return &entry
+}
+
+// change that sets a task back to how it was at an earlier revision
+func restoreTo(revision *models.TaskRevision) func(current *models.Task) (*models.Task, error) {
+	return func(current *models.Task) (*models.Task, error) {
+		restored := *current
+		setEditableFields(&restored, editableFields(&revision.Task))
+		return &restored, validateTask(&restored)
+	}
+}
+
+// change that moves a task to the trash
+func moveToTrash(actor models.Actor) func(current *models.Task) (*models.Task, error) {
+	return func(current *models.Task) (*models.Task, error) {
+		deleted := *current
+		now := time.Now().UTC()
+		deleted.DeletedAt = &now
+		deleted.DeletedBy = actor.UserID
+		return &deleted, nil
+	}
+}
+
+// change that takes a task back out of the trash
+func takeFromTrash(current *models.Task) (*models.Task, error) {
+	restored := *current
+	restored.DeletedAt = nil
+	restored.DeletedBy = ""
+	return &restored, nil
+}
@@ -0,0 +1,128 @@
+package data
+
+// imports
+import (
+	"encoding/json";
+	"errors";
+	"reflect";
+	"sort";
+	"time";
+	"github.com/evanphx/json-patch/v5";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+// patch formats accepted by PatchTask, named by their content type
+const (
+	MergePatchType = "application/merge-patch+json"      // RFC 7396, a partial task, null clears a field
+	JSONPatchType  = "application/json-patch+json"       // RFC 6902, a list of add/remove/replace/move/copy/test operations
+)
+
+var ErrUnsupportedPatchType = UnsupportedMediaTypeError("unsupported_patch_type", "patch must be sent as "+MergePatchType+" or "+JSONPatchType)
+
+// changes to apply to a task, in one of the formats above
+type TaskPatch struct {
+	Type  string      // MergePatchType or JSONPatchType
+	Body  []byte      // the raw patch document
+}
+
+// the part of a task a patch can change, id, owner and version are kept by the server
+type taskFields struct {
+	Title        string       `json:"title"`
+	Description  string       `json:"description"`
+	DueDate      time.Time    `json:"due_date"`
+	Status       string       `json:"status"`
+	AssignedTo   string       `json:"assigned_to"`
+}
+
+func editableFields(task *models.Task) taskFields {
+	return taskFields{Title: task.Title, Description: task.Description, DueDate: task.DueDate, Status: task.Status, AssignedTo: task.AssignedTo}
+}
+
+// copy fields onto task, unassigned tasks go back to their creator like new ones
+func setEditableFields(task *models.Task, fields taskFields) {
+	task.Title = fields.Title
+	task.Description = fields.Description
+	task.DueDate = fields.DueDate
+	task.Status = fields.Status
+	task.AssignedTo = fields.AssignedTo
+	if task.AssignedTo == "" {
+		task.AssignedTo = task.CreatedBy
+	}
+}
+
+// apply patch to a copy of task and validate the result, task itself is left alone
+func applyTaskPatch(task *models.Task, patch TaskPatch) (*models.Task, error) {
+
+	original, err := json.Marshal(editableFields(task))
+	if err != nil {
+		return nil, InternalError(err)
+	}
+
+	var patched []byte
+	switch patch.Type {
+	case MergePatchType:
+		patched, err = jsonpatch.MergePatch(original, patch.Body)
+	case JSONPatchType:
+		var operations jsonpatch.Patch
+		operations, err = jsonpatch.DecodePatch(patch.Body)
+		if err == nil {
+			patched, err = operations.Apply(original)
+		}
+	default:
+		return nil, ErrUnsupportedPatchType
+	}
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return nil, ValidationError("patch_test_failed", "a test operation in the patch did not match the task")
+	}
+	if err != nil {
+		return nil, ValidationError("invalid_patch", "patch can not be applied: "+err.Error())
+	}
+
+	// only editable fields may be added, everything else is rejected instead of silently dropped
+	var present map[string]json.RawMessage
+	err = json.Unmarshal(patched, &present)
+	if err != nil {
+		return nil, ValidationError("invalid_patch", "patched task must be a json object")
+	}
+	var unknown []FieldError
+	for name := range present {
+		switch name {
+		case "title", "description", "due_date", "status", "assigned_to":
+		default:
+			unknown = append(unknown, FieldError{Field: name, Code: "not_writable", Message: "is not a field a patch can change"})
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Slice(unknown, func(i, j int) bool { return unknown[i].Field < unknown[j].Field })
+		return nil, ValidationError("invalid_patch", "patch changes fields that can't be changed", unknown...)
+	}
+
+	var fields taskFields
+	err = json.Unmarshal(patched, &fields)
+	if err != nil {
+		return nil, patchedFieldError(err)
+	}
+
+	result := *task
+	setEditableFields(&result, fields)
+	err = validateTask(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// describe a patched value of the wrong type
+func patchedFieldError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Type == reflect.TypeOf(time.Time{}):
+		return ValidationError("invalid_task", "patched task is invalid", FieldError{Field: typeErr.Field, Code: "invalid", Message: "must be in ISO 8601 format like '2023-12-31T00:00:00Z'"})
+	case errors.As(err, &typeErr):
+		return ValidationError("invalid_task", "patched task is invalid", FieldError{Field: typeErr.Field, Code: "invalid_type", Message: "must be a " + typeErr.Type.String()})
+	case errors.As(err, &timeErr):
+		return ValidationError("invalid_task", "patched task is invalid", FieldError{Field: "due_date", Code: "invalid", Message: "must be in ISO 8601 format like '2023-12-31T00:00:00Z'"})
+	}
+	return ValidationError("invalid_task", "patched task is invalid: "+err.Error())
+}
@@ -0,0 +1,70 @@
+package data
+
+// imports
+import (
+	"context";
+	"log/slog";
+	"sync";
+	"time";
+)
+
+// removes tasks for good once they have been in the trash longer than the retention period
+type TaskPurger struct {
+	tasks      TaskManager            // where the trash lives
+	retention  time.Duration          // how long deleted tasks can still be restored
+	logger     *slog.Logger           // purge results and failures
+	cancel     context.CancelFunc     // stops the loop, cutting a running purge short
+	done       chan struct{}          // closed once the loop has returned
+	stopOnce   sync.Once              // makes Close safe to call twice
+}
+
+// start purging the trash every interval until Close
+func NewTaskPurger(tasks TaskManager, retention, interval time.Duration, logger *slog.Logger) *TaskPurger {
+	ctx, cancel := context.WithCancel(context.Background())
+	purger := &TaskPurger{
+		tasks:     tasks,
+		retention: retention,
+		logger:    logger,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	go purger.run(ctx, interval)
+	return purger
+}
+
+func (purger *TaskPurger) run(ctx context.Context, interval time.Duration) {
+
+	defer close(purger.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purger.purge(ctx, now)
+		}
+	}
+}
+
+// one pass over the trash, a failure is logged and retried on the next tick
+func (purger *TaskPurger) purge(ctx context.Context, now time.Time) {
+	purged, err := purger.tasks.PurgeDeletedTasks(ctx, now.Add(-purger.retention))
+	if err != nil {
+		purger.logger.ErrorContext(ctx, "failed to purge deleted tasks", "purged", purged, "error", err)
+		return
+	}
+	if purged > 0 {
+		purger.logger.InfoContext(ctx, "purged deleted tasks", "purged", purged, "retention", purger.retention.String())
+	}
+}
+
+// stop purging and wait for a running purge to give up
+func (purger *TaskPurger) Close() error {
+	purger.stopOnce.Do(purger.cancel)
+	<-purger.done
+	return nil
+}
@@ -0,0 +1,265 @@
+package data
+
+// imports
+import (
+	"encoding/base64";
+	"encoding/json";
+	"fmt";
+	"strings";
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+	"go.mongodb.org/mongo-driver/bson";
+	"go.mongodb.org/mongo-driver/bson/primitive";
+)
+
+const (
+	DefaultTaskPageSize  = 20       // page size when no limit is given
+	MaxTaskPageSize      = 100      // largest page a client can ask for
+)
+
+var ErrInvalidTaskQuery = ValidationError("invalid_task_query", "invalid task query")
+
+// invalid query parameter, matches ErrInvalidTaskQuery and names the offending parameter
+func invalidTaskQuery(param, message string) error {
+	return ValidationError(ErrInvalidTaskQuery.Code, "invalid task query: "+message, FieldError{Field: param, Code: "invalid", Message: message})
+}
+
+// how to filter, sort and page through tasks
+type TaskQuery struct {
+	Limit        int             // page size, DefaultTaskPageSize if zero
+	Cursor       string          // next_cursor of the previous page, empty for the first page
+	SortBy       string          // "due_date", "title", "status", or empty for creation order
+	SortDesc     bool            // sort descending instead of ascending
+	Status       string          // only tasks with this status, if set
+	DueBefore    time.Time       // only tasks due before this time, if set
+	DueAfter     time.Time       // only tasks due after this time, if set
+}
+
+// one page of tasks
+type TaskPage struct {
+	Tasks        []models.Task   `json:"tasks"`                      // tasks on this page
+	NextCursor   string          `json:"next_cursor,omitempty"`      // pass as cursor to get the next page, empty on the last page
+	Total        int64           `json:"total"`                      // number of tasks matching the filters across all pages
+}
+
+// position after the last task of a page, opaque to clients
+type taskCursor struct {
+	SortBy       string          `json:"s"`       // sort field the cursor was created for
+	SortDesc     bool            `json:"d"`       // sort direction the cursor was created for
+	Value        string          `json:"v"`       // sort value of the last task
+	ID           string          `json:"id"`      // id of the last task, breaks ties between equal sort values
+}
+
+// check the query and fill in defaults
+func (query *TaskQuery) normalize() error {
+
+	if query.Limit == 0 {
+		query.Limit = DefaultTaskPageSize
+	}
+	if query.Limit < 1 || query.Limit > MaxTaskPageSize {
+		return invalidTaskQuery("limit", fmt.Sprintf("limit must be between 1 and %d", MaxTaskPageSize))
+	}
+
+	switch query.SortBy {
+	case "", "due_date", "title", "status":
+	default:
+		return invalidTaskQuery("sort", "can only sort by due_date, title or status")
+	}
+
+	if query.Status != "" && query.Status != "pending" && query.Status != "in_progress" && query.Status != "completed" {
+		return invalidTaskQuery("status", "status must be pending, in_progress or completed")
+	}
+
+	if !query.DueBefore.IsZero() && !query.DueAfter.IsZero() && !query.DueAfter.Before(query.DueBefore) {
+		return invalidTaskQuery("due_after", "due_after must be before due_before")
+	}
+
+	return nil
+}
+
+// sort value of a task as stored in a cursor
+func taskSortValue(task *models.Task, sortBy string) string {
+	switch sortBy {
+	case "due_date":
+		return task.DueDate.UTC().Format(time.RFC3339Nano)
+	case "title":
+		return task.Title
+	case "status":
+		return task.Status
+	}
+	return ""
+}
+
+func encodeTaskCursor(query *TaskQuery, last *models.Task) string {
+	raw, _ := json.Marshal(taskCursor{
+		SortBy:   query.SortBy,
+		SortDesc: query.SortDesc,
+		Value:    taskSortValue(last, query.SortBy),
+		ID:       last.ID.Hex(),
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decode the query's cursor, nil for the first page
+func decodeTaskCursor(query *TaskQuery) (*taskCursor, error) {
+
+	if query.Cursor == "" {
+		return nil, nil
+	}
+
+	invalid := invalidTaskQuery("cursor", "invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var cursor taskCursor
+	err = json.Unmarshal(raw, &cursor)
+	if err != nil {
+		return nil, invalid
+	}
+
+	// a cursor only makes sense for the ordering it was created with
+	if cursor.SortBy != query.SortBy || cursor.SortDesc != query.SortDesc {
+		return nil, invalidTaskQuery("cursor", "cursor was created for a different sort order")
+	}
+
+	_, err = primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return nil, invalid
+	}
+	if cursor.SortBy == "due_date" {
+		_, err = time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, invalid
+		}
+	}
+
+	return &cursor, nil
+}
+
+// whether a task matches the query's filters (memory equivalent of taskFilter)
+func matchesTaskQuery(query *TaskQuery, task *models.Task) bool {
+	if query.Status != "" && task.Status != query.Status {
+		return false
+	}
+	if !query.DueBefore.IsZero() && !task.DueDate.Before(query.DueBefore) {
+		return false
+	}
+	if !query.DueAfter.IsZero() && !task.DueDate.After(query.DueAfter) {
+		return false
+	}
+	return true
+}
+
+// compare two tasks in query order, ties broken by id (memory equivalent of taskSort)
+func compareTasks(query *TaskQuery, a, b *models.Task) int {
+
+	result := 0
+	switch query.SortBy {
+	case "due_date":
+		result = a.DueDate.Compare(b.DueDate)
+	case "title":
+		result = strings.Compare(a.Title, b.Title)
+	case "status":
+		result = strings.Compare(a.Status, b.Status)
+	}
+	if result == 0 {
+		result = strings.Compare(a.ID.Hex(), b.ID.Hex())
+	}
+
+	if query.SortDesc {
+		return -result
+	}
+	return result
+}
+
+// whether a task comes after the cursor in query order
+func afterTaskCursor(query *TaskQuery, cursor *taskCursor, task *models.Task) bool {
+
+	if cursor == nil {
+		return true
+	}
+
+	objID, _ := primitive.ObjectIDFromHex(cursor.ID)
+	last := models.Task{ID: objID}
+	switch query.SortBy {
+	case "due_date":
+		last.DueDate, _ = time.Parse(time.RFC3339Nano, cursor.Value)
+	case "title":
+		last.Title = cursor.Value
+	case "status":
+		last.Status = cursor.Value
+	}
+
+	return compareTasks(query, task, &last) > 0
+}
+
+// cut the extra task fetched beyond the limit and turn it into a next cursor
+func newTaskPage(query *TaskQuery, tasks []models.Task, total int64) *TaskPage {
+
+	page := &TaskPage{Tasks: tasks, Total: total}
+	if len(tasks) > query.Limit {
+		page.Tasks = tasks[:query.Limit]
+		page.NextCursor = encodeTaskCursor(query, &page.Tasks[query.Limit-1])
+	}
+
+	return page
+}
+
+// mongodb filter for the query's filters, visibility and cursor
+func taskFilter(actor models.Actor, query *TaskQuery, cursor *taskCursor) bson.M {
+
+	conditions := bson.A{visibilityFilter(actor)}
+
+	if query.Status != "" {
+		conditions = append(conditions, bson.M{"status": query.Status})
+	}
+	if !query.DueBefore.IsZero() {
+		conditions = append(conditions, bson.M{"due_date": bson.M{"$lt": query.DueBefore}})
+	}
+	if !query.DueAfter.IsZero() {
+		conditions = append(conditions, bson.M{"due_date": bson.M{"$gt": query.DueAfter}})
+	}
+
+	if cursor != nil {
+		objID, _ := primitive.ObjectIDFromHex(cursor.ID)
+
+		op := "$gt"
+		if query.SortDesc {
+			op = "$lt"
+		}
+
+		if query.SortBy == "" {
+			conditions = append(conditions, bson.M{"_id": bson.M{op: objID}})
+		} else {
+			var value interface{} = cursor.Value
+			if query.SortBy == "due_date" {
+				value, _ = time.Parse(time.RFC3339Nano, cursor.Value)
+			}
+
+			// strictly past the last sort value, or equal to it with a later id
+			conditions = append(conditions, bson.M{"$or": bson.A{
+				bson.M{query.SortBy: bson.M{op: value}},
+				bson.M{query.SortBy: value, "_id": bson.M{op: objID}},
+			}})
+		}
+	}
+
+	return bson.M{"$and": conditions}
+}
+
+// mongodb sort for the query, ties broken by id (same order as compareTasks)
+func taskSort(query *TaskQuery) bson.D {
+
+	direction := 1
+	if query.SortDesc {
+		direction = -1
+	}
+
+	if query.SortBy == "" {
+		return bson.D{{Key: "_id", Value: direction}}
+	}
+	return bson.D{{Key: query.SortBy, Value: direction}, {Key: "_id", Value: direction}}
+}
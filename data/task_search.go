@@ -0,0 +1,186 @@
+package data
+
+// imports
+import (
+	"fmt";
+	"html";
+	"strings";
+	"unicode";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+const (
+	titleSearchWeight        = 3      // a match in the title counts three times as much as one in the description
+	descriptionSearchWeight  = 1
+	snippetContext           = 40     // characters kept on each side of the first match in a snippet
+)
+
+// one search hit
+type TaskSearchResult struct {
+	Task         models.Task        `json:"task"`            // matching task
+	Score        float64            `json:"score"`           // relevance, higher is better
+	Highlights   TaskHighlights     `json:"highlights"`      // matching parts of the task with terms wrapped in <em>
+}
+
+// snippets of the fields that matched, empty if the field didn't match
+type TaskHighlights struct {
+	Title        string             `json:"title,omitempty"`
+	Description  string             `json:"description,omitempty"`
+}
+
+// split text into lowercase words. the mongodb text index uses language "none",
+// so it tokenizes the same way: no stemming and no stop words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// unique search terms of a query, in order
+func searchTerms(query string) ([]string, error) {
+
+	seen := map[string]bool{}
+	terms := []string{}
+	for _, term := range tokenize(query) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	if len(terms) == 0 {
+		return nil, invalidTaskQuery("q", "search query must contain at least one word")
+	}
+
+	return terms, nil
+}
+
+// relevance of one field: weighted term frequency, damped for long fields (shape of mongodb's text score)
+func fieldScore(text string, terms []string, weight float64) float64 {
+
+	words := tokenize(text)
+	if len(words) == 0 {
+		return 0
+	}
+
+	wanted := map[string]bool{}
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	matches := 0
+	for _, word := range words {
+		if wanted[word] {
+			matches++
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	return weight * float64(matches) * (0.5 + 0.5 / float64(len(words)))
+}
+
+// relevance of a task for the terms, zero if nothing matches (memory equivalent of the text index)
+func scoreTask(task *models.Task, terms []string) float64 {
+	return fieldScore(task.Title, terms, titleSearchWeight) + fieldScore(task.Description, terms, descriptionSearchWeight)
+}
+
+// html-escaped snippet around the first matching word, with every matching word wrapped in <em>
+func highlight(text string, terms []string) string {
+
+	wanted := map[string]bool{}
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	runes := []rune(text)
+	var out strings.Builder
+	first := -1
+	start := -1
+
+	// walk words, copying text and marking matches
+	flush := func(end int) {
+		word := string(runes[start:end])
+		if wanted[strings.ToLower(word)] {
+			if first < 0 {
+				first = out.Len()
+			}
+			out.WriteString("<em>" + html.EscapeString(word) + "</em>")
+		} else {
+			out.WriteString(html.EscapeString(word))
+		}
+		start = -1
+	}
+	for i, r := range runes {
+		isWord := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord {
+			if start >= 0 {
+				flush(i)
+			}
+			out.WriteString(html.EscapeString(string(r)))
+		}
+	}
+	if start >= 0 {
+		flush(len(runes))
+	}
+
+	if first < 0 {
+		return ""
+	}
+
+	// trim to some context around the first match
+	marked := out.String()
+	from := nearestSpace(marked, first - snippetContext, -1)
+	to := nearestSpace(marked, first + snippetContext * 2, 1)
+
+	snippet := strings.TrimSpace(marked[from:to])
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(marked) {
+		snippet += "…"
+	}
+
+	return snippet
+}
+
+// move an offset to the closest space in the given direction, so snippets never cut words or tags
+func nearestSpace(text string, offset int, direction int) int {
+	if offset <= 0 {
+		return 0
+	}
+	if offset >= len(text) {
+		return len(text)
+	}
+	for offset > 0 && offset < len(text) && text[offset] != ' ' {
+		offset += direction
+	}
+	return offset
+}
+
+// check the requested number of results, DefaultTaskPageSize if zero
+func searchLimit(limit int) (int, error) {
+	if limit == 0 {
+		return DefaultTaskPageSize, nil
+	}
+	if limit < 1 || limit > MaxTaskPageSize {
+		return 0, invalidTaskQuery("limit", fmt.Sprintf("limit must be between 1 and %d", MaxTaskPageSize))
+	}
+	return limit, nil
+}
+
+// build a search result with highlighted snippets for a matching task
+func newTaskSearchResult(task models.Task, score float64, terms []string) TaskSearchResult {
+	return TaskSearchResult{
+		Task:  task,
+		Score: score,
+		Highlights: TaskHighlights{
+			Title:       highlight(task.Title, terms),
+			Description: highlight(task.Description, terms),
+		},
+	}
+}
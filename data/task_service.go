@@ -5,36 +5,67 @@ import (
 	"context";
 	"errors";
 	"fmt";
-	"log";
+	"log/slog";
+	"slices";
+	"strings";
 	"time";
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
 	"go.mongodb.org/mongo-driver/bson";
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo";
 	"go.mongodb.org/mongo-driver/bson/primitive";
 	"go.mongodb.org/mongo-driver/mongo";
 	"go.mongodb.org/mongo-driver/mongo/options";
+	"go.mongodb.org/mongo-driver/mongo/readpref";
 )
 
+// returned when the actor can see a task but isn't allowed to change it
+var ErrTaskForbidden = ForbiddenError("task_forbidden", "only the task owner or a user allowed to change any task can modify this task")
+
+// versions of a task a change may be made on, taken from the entity tags in If-Match
+type VersionMatch []int64
+
+// pass to UpdateTask/PatchTask/DeleteTask/RestoreDeletedTask/RestoreTaskRevision to skip the version check
+var AnyVersion VersionMatch
+
+// whether a task at version may be changed
+func (versions VersionMatch) allows(version int64) bool {
+	return versions == nil || slices.Contains(versions, version)
+}
+
+// how often modifyTask re-reads a task that changed under it before giving up
+const maxModifyAttempts = 3
+
 type TaskManager interface {
-	CreateTask(task *models.Task) (*models.Task, error)                     // create new task with validation
-	DeleteTask(taskID string) error                 			// delete existing task or return error if not found
-	GetAllTasks() ([]models.Task, error)         				// get all tasks in the system
-	GetTaskByID(taskID string) (*models.Task, error) 		        // get specific task by id or return error if not found
-	UpdateTask(taskID string, task *models.Task) (*models.Task, error)      // update existing task or return error if not found
+	CreateTask(ctx context.Context, actor models.Actor, task *models.Task) (*models.Task, error)     // create new task owned by actor with validation
+	DeleteTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch) error                 	// move task owned by actor (any task with tasks:delete:any) to the trash if it is still at one of versions, or return error if not found
+	GetAllTasks(ctx context.Context, actor models.Actor, query TaskQuery) (*TaskPage, error)	// get one page of tasks visible to actor (every task with tasks:read:any)
+	GetDeletedTasks(ctx context.Context, actor models.Actor) ([]models.Task, error)     // tasks in the trash actor could restore, most recently deleted first
+	GetTaskByID(ctx context.Context, actor models.Actor, taskID string) (*models.Task, error) 	// get specific task visible to actor or return error if not found
+	GetTaskHistory(ctx context.Context, actor models.Actor, taskID string) ([]models.TaskRevision, error)     // every recorded change of a task visible to actor, oldest first
+	PatchTask(ctx context.Context, actor models.Actor, taskID string, patch TaskPatch, versions VersionMatch) (*models.Task, error)        // patch task owned by actor (any task with tasks:update:any) if it is still at one of versions, or return error if not found
+	PurgeDeletedTasks(ctx context.Context, deletedBefore time.Time) (int64, error)     // remove tasks for good that went to the trash before deletedBefore, returns how many
+	RestoreDeletedTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch) (*models.Task, error)     // take task owned by actor (any task with tasks:delete:any) out of the trash if it is still at one of versions
+	RestoreTaskRevision(ctx context.Context, actor models.Actor, taskID string, revision int64, versions VersionMatch) (*models.Task, error)     // set task owned by actor (any task with tasks:update:any) back to an earlier revision, if it is still at one of versions
+	SearchTasks(ctx context.Context, actor models.Actor, query string, limit int) ([]TaskSearchResult, error)	// full-text search over titles and descriptions of tasks visible to actor
+	UpdateTask(ctx context.Context, actor models.Actor, taskID string, task *models.Task, versions VersionMatch) (*models.Task, error)      // replace task owned by actor (any task with tasks:update:any) if it is still at one of versions, or return error if not found
 }
 
 type MongoDBTaskManager struct {
 	client     	 *mongo.Client      // connection to mongodb
 	database         string             // which database to use
 	collection       string             // which collection to work with
+	historyCollection string            // which collection holds task history
+	users            UserRepository     // assignees are looked up here, on the same connection
+	timeout          time.Duration      // deadline for each query, on top of the caller's context
+	indexes          []string           // names of the indexes created at startup
+	historyIndexes   []string           // names of the history indexes created at startup
+	logger           *slog.Logger       // history entries that could not be written after their change was saved
 }
 
-// create a new connection to mongodb
-func NewMongoDBTaskManager(uri, db, colln string) (*MongoDBTaskManager, error) {
+// create a new connection to mongodb, ctx bounds connecting and index creation. userColln is only read, to check assignees
+func NewMongoDBTaskManager(ctx context.Context, uri, db, colln, historyColln, userColln string, timeout time.Duration, logger *slog.Logger) (*MongoDBTaskManager, error) {
 	
-	clientOptions := options.Client().ApplyURI(uri)    // set client options
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)    // set timeout
-	defer cancel()
+	clientOptions := options.Client().ApplyURI(uri).SetMonitor(otelmongo.NewMonitor())    // set client options, one span per mongodb command
 	 
 	client, err := mongo.Connect(ctx, clientOptions)      // trying to connect with error handling 
 	if err != nil {
@@ -46,189 +77,614 @@ func NewMongoDBTaskManager(uri, db, colln string) (*MongoDBTaskManager, error) {
 		return nil, err
 	}
 
-	log.Println("Connected to MongoDB!")
-	return &MongoDBTaskManager{
+	taskServ := &MongoDBTaskManager{
 		client:     client,
 		database:   db,
 		collection: colln,
-	}, nil
+		historyCollection: historyColln,
+		users:      &MongoDBUserRepository{client: client, database: db, collection: userColln, timeout: timeout},      // its indexes are created by NewMongoDBUserRepository
+		timeout:    timeout,
+		logger:     logger,
+	}
+
+	err = taskServ.ensureIndexes(ctx)      // indexes backing visibility, filters and sorting
+	if err != nil {
+		return nil, err
+	}
+
+	return taskServ, nil
 }
 
-// add new task to database 
-func (taskServ *MongoDBTaskManager) collectionRef() *mongo.Collection {
-	return taskServ.client.Database(taskServ.database).Collection(taskServ.collection)
+// create the indexes task queries rely on (no-op for indexes that already exist)
+func (taskServ *MongoDBTaskManager) ensureIndexes(ctx context.Context) error {
+	names, err := taskServ.collectionRef().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_by", Value: 1}}},
+		{Keys: bson.D{{Key: "assigned_to", Value: 1}}},
+		{Keys: bson.D{{Key: "due_date", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}},      // trash listing and purging
+		{
+			// full-text search, language "none" so matching is the same as the in-memory tokenizer
+			Keys: bson.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().
+				SetName("task_text").
+				SetDefaultLanguage("none").
+				SetWeights(bson.D{{Key: "title", Value: titleSearchWeight}, {Key: "description", Value: descriptionSearchWeight}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	taskServ.indexes = names
+
+	// one entry per task version, a second writer recording the same revision fails instead of forking history
+	names, err = taskServ.historyRef().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "task_id", Value: 1}, {Key: "revision", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	taskServ.historyIndexes = names
+	return err
 }
 
-func (taskServ *MongoDBTaskManager) CreateTask(task *models.Task) (*models.Task, error) {
+// match a task still at version, tasks stored before versioning have no version field and count as version 0
+func versionFilter(version int64) any {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
 
-	// validate task fields before creation
+// shared validation for a task's fields, used for new, replaced and patched tasks by every TaskManager implementation
+func validateTask(task *models.Task) error {
+	var fields []FieldError      // report every problem at once, not just the first
 	if task.Title == "" {
-		return nil, errors.New("task title can not be empty")
-	}
-	if task.Description == "" {
-		return nil, errors.New("task description can not be empty")
+		fields = append(fields, FieldError{Field: "title", Code: "required", Message: "task title can not be empty"})
 	}
 	if task.DueDate.IsZero() {
-		return nil, errors.New("task duedate can not be empty")
+		fields = append(fields, FieldError{Field: "due_date", Code: "required", Message: "task duedate can not be empty"})
+	}
+	switch task.Status {
+	case "pending", "in_progress", "completed":
+	case "":
+		fields = append(fields, FieldError{Field: "status", Code: "required", Message: "task status can not be empty"})
+	default:
+		fields = append(fields, FieldError{Field: "status", Code: "oneof", Message: "must be one of: pending in_progress completed"})
+	}
+	if len(fields) > 0 {
+		return ValidationError("invalid_task", "task is invalid", fields...)
+	}
+	return nil
+}
+
+// a task can only be assigned to a registered user, before is nil for new tasks and unchanged assignees aren't looked up again
+func checkAssignee(ctx context.Context, users UserRepository, before, after *models.Task) error {
+
+	if after.AssignedTo == after.CreatedBy || (before != nil && after.AssignedTo == before.AssignedTo) {
+		return nil
+	}
+
+	_, err := users.FindByID(ctx, after.AssignedTo)
+	if err == ErrUserNotFound {
+		return ValidationError("invalid_task", "task is invalid", FieldError{Field: "assigned_to", Code: "unknown_user", Message: "no user with this id"})
+	}
+	if err != nil {
+		return InternalError(fmt.Errorf("failed to look up assignee: %w", err))
+	}
+	return nil
+}
+
+// record who owns a new task, assigning it to its creator unless told otherwise.
+// new tasks are always live, a client can't create one straight into the trash
+func setTaskOwner(actor models.Actor, task *models.Task) {
+	task.CreatedBy = actor.UserID
+	task.DeletedAt = nil
+	task.DeletedBy = ""
+	if task.AssignedTo == "" {
+		task.AssignedTo = actor.UserID
+	}
+}
+
+// users allowed to read any task see every task, everyone else only tasks they created or are assigned to. tasks in the trash are hidden from everyone
+func canViewTask(actor models.Actor, task *models.Task) bool {
+	return task.DeletedAt == nil && (actor.Can(models.PermTasksReadAny) || task.CreatedBy == actor.UserID || task.AssignedTo == actor.UserID)
+}
+
+// users holding anyPermission can change every task, everyone else only tasks they created
+func canModifyTask(actor models.Actor, task *models.Task, anyPermission string) bool {
+	return actor.Can(anyPermission) || task.CreatedBy == actor.UserID
+}
+
+// the ":any" permission needed to make a change to someone else's task, by history action
+func modifyPermission(action string) string {
+	if action == models.TaskDeleted || action == models.TaskUndeleted {
+		return models.PermTasksDeleteAny
+	}
+	return models.PermTasksUpdateAny
+}
+
+// tasks a change can be looked up in, those actor can see plus every task when they hold anyPermission
+func canFindTaskToModify(actor models.Actor, task *models.Task, anyPermission string) bool {
+	return task.DeletedAt == nil && (actor.Can(anyPermission) || canViewTask(actor, task))
+}
+
+// tasks in the trash are only seen by whoever could restore them
+func canViewDeletedTask(actor models.Actor, task *models.Task) bool {
+	return task.DeletedAt != nil && canModifyTask(actor, task, models.PermTasksDeleteAny)
+}
+
+// mongodb equivalent of canViewTask, a missing deleted_at matches nil too
+func visibilityFilter(actor models.Actor) bson.M {
+	if actor.Can(models.PermTasksReadAny) {
+		return bson.M{"deleted_at": nil}
+	}
+	return bson.M{"deleted_at": nil, "$or": bson.A{
+		bson.M{"created_by": actor.UserID},
+		bson.M{"assigned_to": actor.UserID},
+	}}
+}
+
+// mongodb equivalent of canFindTaskToModify
+func modifyFilter(actor models.Actor, anyPermission string) bson.M {
+	if actor.Can(anyPermission) {
+		return bson.M{"deleted_at": nil}
+	}
+	return visibilityFilter(actor)
+}
+
+// mongodb equivalent of canViewDeletedTask
+func trashFilter(actor models.Actor) bson.M {
+	filter := bson.M{"deleted_at": bson.M{"$ne": nil}}
+	if !actor.Can(models.PermTasksDeleteAny) {
+		filter["created_by"] = actor.UserID
+	}
+	return filter
+}
+
+// add new task to database 
+func (taskServ *MongoDBTaskManager) collectionRef() *mongo.Collection {
+	return taskServ.client.Database(taskServ.database).Collection(taskServ.collection)
+}
+
+func (taskServ *MongoDBTaskManager) historyRef() *mongo.Collection {
+	return taskServ.client.Database(taskServ.database).Collection(taskServ.historyCollection)
+}
+
+// fail if an index created at startup has been dropped since
+func (taskServ *MongoDBTaskManager) CheckIndexes(ctx context.Context) error {
+	return errors.Join(
+		checkIndexes(ctx, taskServ.collectionRef(), taskServ.indexes),
+		checkIndexes(ctx, taskServ.historyRef(), taskServ.historyIndexes),
+	)
+}
+
+func (taskServ *MongoDBTaskManager) CreateTask(ctx context.Context, actor models.Actor, task *models.Task) (*models.Task, error) {
+
+	err := validateTask(task)      // validate task fields before creation
+	if err != nil {
+		return nil, err
 	}
-	if task.Status == "" {
-		return nil, errors.New("task status can not be empty")
+
+	setTaskOwner(actor, task)
+	err = checkAssignee(ctx, taskServ.users, nil, task)
+	if err != nil {
+		return nil, err
 	}
 
 	collection := taskServ.collectionRef()
 
-	contx, cancel := context.WithTimeout(context.Background(), 5*time.Second)     // set timeout
+	contx, cancel := context.WithTimeout(ctx, taskServ.timeout)     // set timeout
 	defer cancel()
 
 	task.ID = primitive.NewObjectID()               // create a unique id for the new task
-	_, err := collection.InsertOne(contx, task)     // create the new task with error handling
+	task.Version = 1                                // first version, bumped on every update
+	_, err = collection.InsertOne(contx, task)     // create the new task with error handling
 	if err != nil {
-        return nil, fmt.Errorf("failed to create task: %v", err)
+        return nil, InternalError(err)
     }
 
+	taskServ.appendRevision(contx, newTaskRevision(models.TaskRevision{Action: models.TaskCreated}, actor, nil, task))
+
 	return task, nil       // return the new created task and nil
 }
 
-// remove a task from the database 
-func (taskServ *MongoDBTaskManager) DeleteTask(taskID string) error {
+// move a task to the trash, it stays there until restored or purged
+func (taskServ *MongoDBTaskManager) DeleteTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch) error {
+	_, err := taskServ.modifyTask(ctx, actor, taskID, versions, false, models.TaskRevision{Action: models.TaskDeleted}, moveToTrash(actor))
+	return err
+}
+
+func (taskServ *MongoDBTaskManager) GetAllTasks(ctx context.Context, actor models.Actor, query TaskQuery) (*TaskPage, error) {
 	
-	var task models.Task
-	collection := taskServ.collectionRef()
+	err := query.normalize()      // validate query and apply defaults
+	if err != nil {
+		return nil, err
+	}
 
-	objID, err := primitive.ObjectIDFromHex(taskID)       // convert string id to mongodb's id format with error handling 
+	pageCursor, err := decodeTaskCursor(&query)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	contx, cancel := context.WithTimeout(context.Background(), 5*time.Second)        // set timeout
+	allTasks := []models.Task{}
+	collection := taskServ.collectionRef()
+
+	contx, cancel := context.WithTimeout(ctx, taskServ.timeout)      // set timeout
 	defer cancel()
 
-	err = collection.FindOne(contx, bson.M{"_id": objID}).Decode(&task)        // check task with the id in the database
-    if err != nil {
-        if err == mongo.ErrNoDocuments {
-            return errors.New("no task found with this id to delete")
-        }
-        return err
-    }
+	// total across all pages, so the cursor isn't part of the count
+	total, err := collection.CountDocuments(contx, taskFilter(actor, &query, nil))
+	if err != nil {
+		return nil, err
+	}
 
-	_, err = collection.DeleteOne(contx, bson.M{"_id":objID})         // delete the task with error handling
+	// fetch one extra task to know whether there is a next page
+	opts := options.Find().
+		SetSort(taskSort(&query)).
+		SetLimit(int64(query.Limit + 1))
+
+	cursor, err := collection.Find(contx, taskFilter(actor, &query, pageCursor), opts)      // find one page of documents the actor may see
 	if err != nil {
-		return err
+		return nil, err
+	}
+	
+	defer cursor.Close(contx)      // close cursor when done
+
+	err = cursor.All(contx, &allTasks)       // read all result into our slice
+	if err != nil {
+		return nil, err
 	}
 
-	return nil       // return nil
+	return newTaskPage(&query, allTasks, total), nil     // return one page of tasks and nil
 }
 
-func (taskServ *MongoDBTaskManager) GetAllTasks() ([]models.Task, error) {
-	
-	var allTasks []models.Task
+// tasks in the trash actor could restore, most recently deleted first
+func (taskServ *MongoDBTaskManager) GetDeletedTasks(ctx context.Context, actor models.Actor) ([]models.Task, error) {
+
+	deletedTasks := []models.Task{}
 	collection := taskServ.collectionRef()
 
-	contx, cancel := context.WithTimeout(context.Background(), 5*time.Second)      // set timeout
+	contx, cancel := context.WithTimeout(ctx, taskServ.timeout)      // set timeout
 	defer cancel()
 
-	cursor, err := collection.Find(contx, bson.M{})      // find all documents in the collection
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}, {Key: "_id", Value: 1}})
+	cursor, err := collection.Find(contx, trashFilter(actor), opts)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	defer cursor.Close(contx)      // close cursor when done
 
-	err = cursor.All(contx, &allTasks)       // read all result into our slice
+	err = cursor.All(contx, &deletedTasks)
 	if err != nil {
 		return nil, err
 	}
 
-	return allTasks, nil     // return all tasks in the database and nil
+	return deletedTasks, nil
 }
 
 // find one specific task by its id
-func (taskServ *MongoDBTaskManager) GetTaskByID(taskID string) (*models.Task, error) {
+func (taskServ *MongoDBTaskManager) GetTaskByID(ctx context.Context, actor models.Actor, taskID string) (*models.Task, error) {
 	
 	var task models.Task
 	collection := taskServ.collectionRef()
 
-	objID, err := primitive.ObjectIDFromHex(taskID)      // convert string id to mongodb's format with error handling 
+	objID, err := parseTaskID(taskID)      // rejects ids that are not in mongodb's format
 	if err != nil {
 		return nil, err
 	}
 
-	contx, cancel := context.WithTimeout(context.Background(), 5*time.Second)      // set timeout
+	contx, cancel := context.WithTimeout(ctx, taskServ.timeout)      // set timeout
 	defer cancel()
 
-	err = collection.FindOne(contx, bson.M{"_id":objID}).Decode(&task)      // check if task exists
+	// tasks the actor can't see are reported as missing, so their existence isn't leaked
+	filter := visibilityFilter(actor)
+	filter["_id"] = objID
+
+	err = collection.FindOne(contx, filter).Decode(&task)      // check if task exists
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrTaskNotFound
+	}
 	if err != nil {
-		return nil, errors.New("no task found with this id to see")
+		return nil, err
 	}
 
 	return &task, nil    // return the found task and nil
 }
 
-// update an existing task's details
-func (taskServ *MongoDBTaskManager) UpdateTask(taskID string, taskUpdate *models.Task) (*models.Task, error) {
-	
-	var updatedtask models.Task
+// find tasks by keyword, best matches first
+func (taskServ *MongoDBTaskManager) SearchTasks(ctx context.Context, actor models.Actor, query string, limit int) ([]TaskSearchResult, error) {
+
+	terms, err := searchTerms(query)      // same tokenizing as the in-memory matcher
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err = searchLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
 	collection := taskServ.collectionRef()
 
-	objID, err := primitive.ObjectIDFromHex(taskID)      // convert string id to mongodb's format with error handling 
+	contx, cancel := context.WithTimeout(ctx, taskServ.timeout)      // set timeout
+	defer cancel()
+
+	// terms are passed without quotes or minus signs, so every term is optional like in memory
+	filter := visibilityFilter(actor)
+	filter["$text"] = bson.M{"$search": strings.Join(terms, " ")}
+
+	opts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(contx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	contx, cancel := context.WithTimeout(context.Background(), 5*time.Second)     // set timeout
+	defer cursor.Close(contx)      // close cursor when done
+
+	var scored []struct {
+		models.Task          `bson:",inline"`
+		Score       float64  `bson:"score"`
+	}
+	err = cursor.All(contx, &scored)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]TaskSearchResult, 0, len(scored))
+	for _, hit := range scored {
+		results = append(results, newTaskSearchResult(hit.Task, hit.Score, terms))
+	}
+
+	return results, nil     // return best matches and nil
+}
+
+// replace an existing task's details, fields left out are cleared
+func (taskServ *MongoDBTaskManager) UpdateTask(ctx context.Context, actor models.Actor, taskID string, taskUpdate *models.Task, versions VersionMatch) (*models.Task, error) {
+	return taskServ.modifyTask(ctx, actor, taskID, versions, false, models.TaskRevision{Action: models.TaskUpdated}, func(current *models.Task) (*models.Task, error) {
+		replacement := *current
+		setEditableFields(&replacement, editableFields(taskUpdate))
+		return &replacement, validateTask(&replacement)
+	})
+}
+
+// apply a merge patch or json patch to an existing task
+func (taskServ *MongoDBTaskManager) PatchTask(ctx context.Context, actor models.Actor, taskID string, patch TaskPatch, versions VersionMatch) (*models.Task, error) {
+	return taskServ.modifyTask(ctx, actor, taskID, versions, false, models.TaskRevision{Action: models.TaskUpdated}, func(current *models.Task) (*models.Task, error) {
+		return applyTaskPatch(current, patch)
+	})
+}
+
+// take a task back out of the trash
+func (taskServ *MongoDBTaskManager) RestoreDeletedTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch) (*models.Task, error) {
+	return taskServ.modifyTask(ctx, actor, taskID, versions, true, models.TaskRevision{Action: models.TaskUndeleted}, takeFromTrash)
+}
+
+// read a task (from the trash when deleted is set), let change build its new state and write that back only if nobody
+// changed the task in between, then record it in the history as entry. a lost race is retried against the fresh task,
+// which still has to be at one of versions. with a single expected version the caller gets a version mismatch right away
+func (taskServ *MongoDBTaskManager) modifyTask(ctx context.Context, actor models.Actor, taskID string, versions VersionMatch, deleted bool, entry models.TaskRevision, change func(current *models.Task) (*models.Task, error)) (*models.Task, error) {
+
+	collection := taskServ.collectionRef()
+
+	objID, err := parseTaskID(taskID)      // rejects ids that are not in mongodb's format
+	if err != nil {
+		return nil, err
+	}
+
+	contx, cancel := context.WithTimeout(ctx, taskServ.timeout)     // set timeout
 	defer cancel()
 
-	err = collection.FindOne(contx, bson.M{"_id": objID}).Decode(&updatedtask)     // check if task exists
-    if err != nil {
-        if err == mongo.ErrNoDocuments {
-            return nil, errors.New("no task found with this id to update")
-        }
-        return nil, err
-    }
+	// a user allowed to change any task finds it even if they couldn't read it
+	filter := modifyFilter(actor, modifyPermission(entry.Action))
+	if deleted {
+		filter = trashFilter(actor)
+	}
+	filter["_id"] = objID
+
+	for attempt := 0; attempt < maxModifyAttempts; attempt++ {
+
+		var current models.Task
+		err = collection.FindOne(contx, filter).Decode(&current)     // check if task exists
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrTaskNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !canModifyTask(actor, &current, modifyPermission(entry.Action)) {
+			return nil, ErrTaskForbidden
+		}
+		if !versions.allows(current.Version) {
+			return nil, ErrTaskVersionMismatch
+		}
+
+		changed, err := change(&current)
+		if err != nil {
+			return nil, err
+		}
+		err = checkAssignee(contx, taskServ.users, &current, changed)
+		if err != nil {
+			return nil, err
+		}
+
+		fields := editableFields(changed)
+		set := bson.M{
+			"title":       fields.Title,
+			"description": fields.Description,
+			"due_date":    fields.DueDate,
+			"status":      fields.Status,
+			"assigned_to": fields.AssignedTo,
+		}
+		update := bson.M{
+			"$set": set,
+			"$inc": bson.M{"version": 1},      // every change bumps the version
+		}
+		if changed.DeletedAt != nil {
+			set["deleted_at"] = changed.DeletedAt
+			set["deleted_by"] = changed.DeletedBy
+		} else {
+			update["$unset"] = bson.M{"deleted_at": "", "deleted_by": ""}
+		}
+
+		opts := options.FindOneAndUpdate().        // to get updated document back 
+			SetReturnDocument(options.After)
+
+		// only write over the version that was read, so of two concurrent writers only the first one wins
+		var updatedtask models.Task
+		err = collection.FindOneAndUpdate(
+			contx,
+			bson.M{"_id": objID, "version": versionFilter(current.Version)},
+			update,
+			opts,
+		).Decode(&updatedtask)
+
+		if err == nil {
+			taskServ.appendRevision(contx, newTaskRevision(entry, actor, &current, &updatedtask))
+			return &updatedtask, nil  // return the updated task and nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if len(versions) == 1 {
+			return nil, ErrTaskVersionMismatch      // the task moved past the only version allowed, no need to read it again
+		}
+	}
 
-	update := bson.M{"$set": bson.M{}}        // prepare what we want to change
-	setFields := update["$set"].(bson.M)
+	return nil, ErrTaskVersionMismatch      // kept losing to concurrent writers
+}
 
-	// only update fields that were actually provided
-	if taskUpdate.Title != "" {
-        setFields["title"] = taskUpdate.Title
-    }
-    if taskUpdate.Description != "" {
-        setFields["description"] = taskUpdate.Description
-    }
-    if !taskUpdate.DueDate.IsZero() {
-        setFields["due_date"] = taskUpdate.DueDate
-    }
-    if taskUpdate.Status != "" {
-        setFields["status"] = taskUpdate.Status
-    }
+// record a change, the change itself is already saved so a failure here only loses the history entry.
+// it is logged instead of failing the request, a client retrying after an error would make the change twice
+func (taskServ *MongoDBTaskManager) appendRevision(ctx context.Context, revision *models.TaskRevision) {
+	_, err := taskServ.historyRef().InsertOne(ctx, revision)
+	if err != nil {
+		taskServ.logger.ErrorContext(ctx, "task was saved but its history entry was not", "task_id", revision.TaskID.Hex(), "action", revision.Action, "revision", revision.Revision, "error", err)
+	}
+}
 
-	// stop if nothing valid to update
-	if len(setFields) == 0 {
-        return nil, errors.New("no valid fields provided for update")
-    }
+// every recorded change of a task visible to actor, oldest first
+func (taskServ *MongoDBTaskManager) GetTaskHistory(ctx context.Context, actor models.Actor, taskID string) ([]models.TaskRevision, error) {
+
+	task, err := taskServ.GetTaskByID(ctx, actor, taskID)      // same visibility rules as reading the task
+	if err != nil {
+		return nil, err
+	}
+
+	contx, cancel := context.WithTimeout(ctx, taskServ.timeout)      // set timeout
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "revision", Value: 1}})
+	cursor, err := taskServ.historyRef().Find(contx, bson.M{"task_id": task.ID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []models.TaskRevision{}
+	err = cursor.All(contx, &revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// set a task back to how it was at an earlier revision, recorded as a new revision
+func (taskServ *MongoDBTaskManager) RestoreTaskRevision(ctx context.Context, actor models.Actor, taskID string, revision int64, versions VersionMatch) (*models.Task, error) {
+
+	objID, err := parseTaskID(taskID)      // rejects ids that are not in mongodb's format
+	if err != nil {
+		return nil, err
+	}
 
-	opts := options.FindOneAndUpdate().        // to get updated document back 
-		SetReturnDocument(options.After)
+	contx, cancel := context.WithTimeout(ctx, taskServ.timeout)      // set timeout
+	defer cancel()
 
-	// perform update and get the updated task
-	err = collection.FindOneAndUpdate(
-		contx, 
-		bson.M{"_id": objID},
-		update,
-		opts,
-	).Decode(&updatedtask)
+	// unknown tasks and tasks the actor can't change are reported before anything about their revisions
+	filter := modifyFilter(actor, models.PermTasksUpdateAny)
+	filter["_id"] = objID
+	err = taskServ.collectionRef().FindOne(contx, filter).Err()
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	var target models.TaskRevision
+	err = taskServ.historyRef().FindOne(contx, bson.M{"task_id": objID, "revision": revision}).Decode(&target)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrTaskRevisionNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &updatedtask, nil  // return the updated task and nil
+	// permissions are checked on the current task, like any other update
+	return taskServ.modifyTask(ctx, actor, taskID, versions, false, models.TaskRevision{Action: models.TaskRestored, RestoredFrom: revision}, restoreTo(&target))
 }
 
-// close mongodb connection
-func (taskServ *MongoDBTaskManager) Close() error {
-	contx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// remove tasks that went to the trash before deletedBefore for good, together with their history
+func (taskServ *MongoDBTaskManager) PurgeDeletedTasks(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	collection := taskServ.collectionRef()
+
+	contx, cancel := context.WithTimeout(ctx, taskServ.timeout)      // set timeout
 	defer cancel()
-	return taskServ.client.Disconnect(contx)
+
+	cursor, err := collection.Find(contx, bson.M{"deleted_at": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []models.Task
+	err = cursor.All(contx, &expired)
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for i := range expired {
+		task := &expired[i]
+
+		// a task restored since it was read keeps its new version and is skipped
+		result, err := collection.DeleteOne(contx, bson.M{"_id": task.ID, "version": versionFilter(task.Version), "deleted_at": bson.M{"$lt": deletedBefore}})
+		if err != nil {
+			return purged, err
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		purged++
+
+		// every entry holds a copy of the task, keeping them would keep the task
+		_, err = taskServ.historyRef().DeleteMany(contx, bson.M{"task_id": task.ID})
+		if err != nil {
+			return purged, fmt.Errorf("task %s was purged but its history was not: %w", task.ID.Hex(), err)
+		}
+	}
+
+	return purged, nil
+}
+
+// check that mongodb answers, for readiness probes
+func (taskServ *MongoDBTaskManager) Ping(ctx context.Context) error {
+	return taskServ.client.Ping(ctx, readpref.Primary())
+}
+
+// underlying mongodb connection, so other repositories can share it
+func (taskServ *MongoDBTaskManager) Client() *mongo.Client {
+	return taskServ.client
+}
+
+// close mongodb connection, waiting for in-use connections until ctx is done
+func (taskServ *MongoDBTaskManager) Close(ctx context.Context) error {
+	return taskServ.client.Disconnect(ctx)
 }
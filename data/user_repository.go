@@ -0,0 +1,179 @@
+package data
+
+// imports
+import (
+	"context";
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+	"go.mongodb.org/mongo-driver/bson";
+	"go.mongodb.org/mongo-driver/bson/primitive";
+	"go.mongodb.org/mongo-driver/mongo";
+	"go.mongodb.org/mongo-driver/mongo/options";
+)
+
+var (
+	ErrUserNotFound   = NotFoundError("user_not_found", "user not found")            // no user matches the lookup
+	ErrUsernameTaken  = ConflictError("username_taken", "username already exists")   // another user already has this username
+)
+
+// storage for user accounts, kept separate from task storage
+type UserRepository interface {
+	FindByUsername(ctx context.Context, username string) (*models.User, error)     // find user by username or return ErrUserNotFound
+	FindByID(ctx context.Context, userID string) (*models.User, error)             // find user by id or return ErrUserNotFound
+	Count(ctx context.Context) (int64, error)                                      // number of registered users
+	CountByRole(ctx context.Context, role string) (int64, error)                   // number of users with a role
+	Insert(ctx context.Context, user *models.User) error                             // save a new user or return ErrUsernameTaken
+	SetRole(ctx context.Context, userID string, role string) error                   // change user role or return ErrUserNotFound
+}
+
+type MongoDBUserRepository struct {
+	client           *mongo.Client      // connection to mongodb
+	database         string             // which database to use
+	collection       string             // which collection holds users
+	timeout          time.Duration      // per-query deadline
+	indexes          []string           // names of the indexes created at startup
+}
+
+// create a user repository on an existing mongodb connection
+func NewMongoDBUserRepository(ctx context.Context, client *mongo.Client, db, colln string, timeout time.Duration) (*MongoDBUserRepository, error) {
+
+	userRepo := &MongoDBUserRepository{
+		client:     client,
+		database:   db,
+		collection: colln,
+		timeout:    timeout,
+	}
+
+	names, err := userRepo.collectionRef().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),      // usernames must be unique, even when two registrations race each other
+		},
+		{
+			Keys: bson.D{{Key: "role", Value: 1}},          // checking whether a role is still in use before deleting it
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	userRepo.indexes = names
+
+	return userRepo, nil
+}
+
+func (userRepo *MongoDBUserRepository) collectionRef() *mongo.Collection {
+	return userRepo.client.Database(userRepo.database).Collection(userRepo.collection)
+}
+
+// fail if an index created at startup has been dropped since
+func (userRepo *MongoDBUserRepository) CheckIndexes(ctx context.Context) error {
+	return checkIndexes(ctx, userRepo.collectionRef(), userRepo.indexes)
+}
+
+func (userRepo *MongoDBUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+
+	var user models.User
+	collection := userRepo.collectionRef()
+
+	contx, cancel := context.WithTimeout(ctx, userRepo.timeout)      // set timeout
+	defer cancel()
+
+	err := collection.FindOne(contx, bson.M{"username": username}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (userRepo *MongoDBUserRepository) FindByID(ctx context.Context, userID string) (*models.User, error) {
+
+	var user models.User
+	collection := userRepo.collectionRef()
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserNotFound      // ids are always object ids, so a malformed one can't match
+	}
+
+	contx, cancel := context.WithTimeout(ctx, userRepo.timeout)      // set timeout
+	defer cancel()
+
+	err = collection.FindOne(contx, bson.M{"_id": objID}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (userRepo *MongoDBUserRepository) Count(ctx context.Context) (int64, error) {
+
+	contx, cancel := context.WithTimeout(ctx, userRepo.timeout)      // set timeout
+	defer cancel()
+
+	return userRepo.collectionRef().CountDocuments(contx, bson.D{})
+}
+
+func (userRepo *MongoDBUserRepository) CountByRole(ctx context.Context, role string) (int64, error) {
+
+	contx, cancel := context.WithTimeout(ctx, userRepo.timeout)      // set timeout
+	defer cancel()
+
+	return userRepo.collectionRef().CountDocuments(contx, bson.M{"role": role})
+}
+
+func (userRepo *MongoDBUserRepository) Insert(ctx context.Context, user *models.User) error {
+
+	contx, cancel := context.WithTimeout(ctx, userRepo.timeout)      // set timeout
+	defer cancel()
+
+	objID := primitive.NewObjectID()      // always assigned here, a client-chosen id could take over another user's tasks and sessions
+	_, err := userRepo.collectionRef().InsertOne(contx, bson.M{
+		"_id":      objID,
+		"username": user.Username,
+		"password": user.Password,
+		"role":     user.Role,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUsernameTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	user.ID = objID.Hex()
+	return nil
+}
+
+func (userRepo *MongoDBUserRepository) SetRole(ctx context.Context, userID string, role string) error {
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	contx, cancel := context.WithTimeout(ctx, userRepo.timeout)      // set timeout
+	defer cancel()
+
+	result, err := userRepo.collectionRef().UpdateOne(
+		contx,
+		bson.M{"_id": objID},
+		bson.M{"$set": bson.M{"role": role}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
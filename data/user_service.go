@@ -3,166 +3,346 @@ package data
 // imports
 import (
 	"context";
+	"crypto/rand";
+	"crypto/sha256";
+	"encoding/base64";
+	"encoding/hex";
 	"errors";
 	"fmt";
-	"log";
+	"log/slog";
 	"time";
-	"github.com/dgrijalva/jwt-go";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/auth";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/metrics";
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
-	"go.mongodb.org/mongo-driver/bson";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/tracing";
 	"go.mongodb.org/mongo-driver/bson/primitive";
-	"go.mongodb.org/mongo-driver/mongo";
 	"golang.org/x/crypto/bcrypt";
 )
 
-type UserService struct {
-	db  *MongoDBTaskManager     // reuses existing database connection
-}
+var (
+	ErrInvalidRefreshToken  = UnauthorizedError("invalid_refresh_token", "invalid or expired refresh token")
+	ErrInvalidCredentials   = UnauthorizedError("invalid_credentials", "invalid credentials")
+	ErrRefreshTokenReused   = UnauthorizedError("refresh_token_reused", "refresh token already used, all sessions from this login were revoked")
+	ErrInvalidUserID        = ValidationError("invalid_user_id", "invalid user ID format", FieldError{Field: "id", Code: "invalid", Message: "must be a 24 character hex object id"})
+)
 
-// creates new UserService instance
-func NewUserService(db *MongoDBTaskManager)  *UserService {
-	return &UserService{db: db}
+type UserService struct {
+	users          UserRepository         // where users are persisted
+	refreshTokens  RefreshTokenStore      // where refresh tokens are persisted
+	revocations    RevocationStore        // where revoked access tokens are recorded
+	jwtConfig      config.JWTConfig       // token lifetimes, issuer and audience
+	keys           *auth.KeySet        // keys access tokens are signed with
+	logger         *slog.Logger           // for failures that don't fail the request, like best-effort cleanup
 }
 
-// helper to access users collection
-func (userServ *MongoDBTaskManager) UserCollection() *mongo.Collection {
-	return userServ.client.Database(userServ.database).Collection(userServ.collection)
+// creates new UserService instance on top of any user, refresh token and revocation storage
+func NewUserService(users UserRepository, refreshTokens RefreshTokenStore, revocations RevocationStore, jwtConfig config.JWTConfig, keys *auth.KeySet, logger *slog.Logger)  *UserService {
+	return &UserService{users: users, refreshTokens: refreshTokens, revocations: revocations, jwtConfig: jwtConfig, keys: keys, logger: logger}
 }
 
-func (userServ *UserService) Register(user *models.User) error {
-    
-	collection := userServ.db.UserCollection()      // get user collection 
-	
-	contx, cancel := context.WithTimeout(context.Background(), 5*time.Second)      // set timeout
-	defer cancel()
+func (userServ *UserService) Register(ctx context.Context, user *models.User) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Register")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("user_service", "Register", time.Now(), &err)
 
 	// validate input
+	var fields []FieldError
 	if user.Username == "" {
-		return errors.New("username can not be empty")
+		fields = append(fields, FieldError{Field: "username", Code: "required", Message: "username can not be empty"})
 	}	
 	if user.Password == "" {
-		return errors.New("password can not be empty")
+		fields = append(fields, FieldError{Field: "password", Code: "required", Message: "password can not be empty"})
 	} else if len(user.Password) < 8 {
-		return errors.New("password must be 8+ characters")     // vaid password length is 8+ characters
+		fields = append(fields, FieldError{Field: "password", Code: "too_short", Message: "password must be 8+ characters"})     // vaid password length is 8+ characters
+	}
+	if len(fields) > 0 {
+		return ValidationError("invalid_user", "user is invalid", fields...)
 	}
 
 	// check if user already exists
-	exist := collection.FindOne(contx, bson.M{
-		"username": user.Username,
-	})
-
-	if exist.Err() == nil {
-		return errors.New("username already exists")
+	_, err = userServ.users.FindByUsername(ctx, user.Username)
+	if err == nil {
+		return ErrUsernameTaken
 	}
 
 	// set first user role to admin if user collection is empty
-	count, err := collection.CountDocuments(contx, bson.D{})
+	count, err := userServ.users.Count(ctx)
 	if err != nil {
-		log.Fatalf("failed to check user count : %v", err)
-		return errors.New("internal server error")
+		return InternalError(fmt.Errorf("failed to check user count: %w", err))
 	}
 	
-	user.Role = "user"      // default role
+	user.Role = models.RoleUser      // default role
 	if count == 0 {
-		user.Role = "admin"     // first user becomes admin 
+		user.Role = models.RoleAdmin     // first user becomes admin 
 	} 
 
 	// hash password securely 
 	hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Fatalf("failed to hash password : %v", err)
-		return errors.New("internal server error")
+		return InternalError(fmt.Errorf("failed to hash password: %w", err))
 	}
 
 	user.Password = string(hashed)   // set user password to hashed password
 
-	// save user to database
-	_, err = collection.InsertOne(contx, user)
+	// save user to storage
+	err = userServ.users.Insert(ctx, user)
+	if err == ErrUsernameTaken {
+		return ErrUsernameTaken      // lost a race with a concurrent registration
+	}
 	if err != nil {
-		log.Fatalf("failed to create user : %v", err)
-		return errors.New("internal server error")
+		return InternalError(fmt.Errorf("failed to create user: %w", err))
 	}
 
 	return nil     // success 
 }
 
 // authenticate user
-func (userServ *UserService) Login(credentials *models.Credentials) (string, *models.User, error) {
-	
-	var user models.User
-	collection := userServ.db.UserCollection()      // get user collection 
-	
-	contx, cancel := context.WithTimeout(context.Background(), 5*time.Second)      // set timeout
-	defer cancel()
+func (userServ *UserService) Login(ctx context.Context, credentials *models.Credentials) (tokens *models.TokenPair, user *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Login")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("user_service", "Login", time.Now(), &err)
+	defer countLogin(&err)
 
 	// find user by username
-	err := collection.FindOne(contx, bson.M{"username": credentials.Username,}).Decode(&user)
+	user, err = userServ.users.FindByUsername(ctx, credentials.Username)
 	if err != nil {
-        if err == mongo.ErrNoDocuments {
-            return "", nil, errors.New("user not found")
+        if err == ErrUserNotFound {
+            return nil, nil, ErrInvalidCredentials      // same answer as a wrong password, so usernames can't be probed
         }
-        return "", nil, fmt.Errorf("database error: %v", err)
+        return nil, nil, InternalError(err)
     }
 
 	// verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password))
 	if err != nil {
-		return "", nil, errors.New("invalid credentials")
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	// generate access and refresh tokens, starting a new token family
+	tokens, err = userServ.issueTokens(ctx, user, primitive.NewObjectID().Hex())
+	if err != nil {
+        return nil, nil, err
+    }
+
+	return tokens, user, nil       // success
+}
+
+// count a login attempt, unknown users and wrong passwords are failures, anything else is an error
+func countLogin(err *error) {
+	switch {
+	case *err == nil:
+		metrics.Logins.WithLabelValues("success").Inc()
+	case errors.Is(*err, ErrInvalidCredentials):
+		metrics.Logins.WithLabelValues("failure").Inc()
+	default:
+		metrics.Logins.WithLabelValues("error").Inc()
+	}
+}
+
+// exchange a refresh token for a new token pair, rotating the refresh token
+func (userServ *UserService) RefreshSession(ctx context.Context, rawToken string) (tokens *models.TokenPair, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RefreshSession")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("user_service", "RefreshSession", time.Now(), &err)
+
+	stored, err := userServ.refreshTokens.Find(ctx, hashToken(rawToken))
+	if err == ErrRefreshTokenNotFound {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, InternalError(err)
+	}
+
+	if stored.Revoked || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// a refresh token can only be exchanged once; seeing it again means it leaked,
+	// so every token from the same login is revoked and the user has to log in again
+	swapped, err := userServ.refreshTokens.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return nil, InternalError(err)
+	}
+	if !swapped {
+		// finish revoking even if the client hangs up, a half-revoked family is worse than a slow response
+		err = userServ.refreshTokens.RevokeFamily(context.WithoutCancel(ctx), stored.FamilyID)
+		if err != nil {
+			userServ.logger.ErrorContext(ctx, "failed to revoke refresh token family", "family_id", stored.FamilyID, "error", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	// reload the user so role changes are reflected in the new access token
+	user, err := userServ.users.FindByID(ctx, stored.UserID)
+	if err == ErrUserNotFound {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, InternalError(err)
+	}
+
+	return userServ.issueTokens(ctx, user, stored.FamilyID)
+}
+
+// end the caller's session: revoke the access token in use and, if given, its refresh token family
+func (userServ *UserService) Logout(ctx context.Context, userID, tokenID string, tokenExpiresAt time.Time, rawRefresh string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Logout")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("user_service", "Logout", time.Now(), &err)
+
+	if tokenID != "" {
+		// the verifier accepts tokens for up to ClockSkew past exp, so the entry has to outlive that too
+		err := userServ.revocations.RevokeToken(ctx, tokenID, tokenExpiresAt.Add(userServ.jwtConfig.ClockSkew))
+		if err != nil {
+			return InternalError(err)
+		}
+	}
+
+	if rawRefresh == "" {
+		return nil
+	}
+
+	stored, err := userServ.refreshTokens.Find(ctx, hashToken(rawRefresh))
+	if err == ErrRefreshTokenNotFound {
+		return nil       // nothing left to revoke
+	}
+	if err != nil {
+		return InternalError(err)
 	}
 
+	// never let one user log out another user's session
+	if stored.UserID != userID {
+		return nil
+	}
+
+	err = userServ.refreshTokens.RevokeFamily(ctx, stored.FamilyID)
+	if err != nil {
+		return InternalError(err)
+	}
+
+	return nil
+}
+
+// revoke every access and refresh token issued to a user so far (only admin can do this)
+func (userServ *UserService) RevokeAllSessions(ctx context.Context, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RevokeAllSessions")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("user_service", "RevokeAllSessions", time.Now(), &err)
+
+	_, err = userServ.users.FindByID(ctx, userID)
+	if err == ErrUserNotFound {
+		return err
+	}
+	if err != nil {
+		return InternalError(err)
+	}
+
+	// access tokens issued before now stop working; the entry is only needed until the newest of them
+	// expires, plus the clock skew the verifier still accepts them for after that
+	now := time.Now()
+	err = userServ.revocations.RevokeUser(ctx, userID, now, now.Add(userServ.jwtConfig.AccessTokenTTL + userServ.jwtConfig.ClockSkew))
+	if err != nil {
+		return InternalError(err)
+	}
+
+	err = userServ.refreshTokens.RevokeUser(ctx, userID)
+	if err != nil {
+		return InternalError(err)
+	}
+
+	return nil
+}
+
+// sign an access token and store a new refresh token in the given family
+func (userServ *UserService) issueTokens(ctx context.Context, user *models.User, familyID string) (*models.TokenPair, error) {
+
 	// generate jwt token
-	token, err := GenerateToken(user.ID, user.Username, user.Role)
+	accessToken, err := auth.NewAccessToken(userServ.keys, userServ.jwtConfig, user.ID, user.Username, user.Role)
 	if err != nil {
-        return "", nil, fmt.Errorf("failed to generate token: %v", err)
+        return nil, InternalError(fmt.Errorf("failed to generate token: %w", err))
     }
 
-	return token, &user, nil       // success
+	rawRefresh, err := newOpaqueToken()
+	if err != nil {
+        return nil, InternalError(fmt.Errorf("failed to generate refresh token: %w", err))
+    }
+
+	now := time.Now()
+	err = userServ.refreshTokens.Save(ctx, &models.RefreshToken{
+		ID:        hashToken(rawRefresh),      // only the hash is stored
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		ExpiresAt: now.Add(userServ.jwtConfig.RefreshTokenTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+        return nil, InternalError(fmt.Errorf("failed to store refresh token: %w", err))
+    }
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawRefresh,
+		ExpiresIn:    int64(userServ.jwtConfig.AccessTokenTTL.Seconds()),
+	}, nil
 }
 
-// promote a user to admin role (only admin can do this)
-func (userServ *UserService) PromoteUserToAdmin(userID string) error {
-    
-	collection := userServ.db.UserCollection()      // get user collection 
-    
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)      // set timeout
-    defer cancel()
+// promote a user to admin role and revoke their sessions so it applies right away. only someone holding every
+// permission, in practice another admin, can do this, and nobody can promote themselves
+func (userServ *UserService) PromoteUserToAdmin(ctx context.Context, actor models.Actor, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.PromoteUserToAdmin")
+	defer tracing.End(span, &err)
+	defer metrics.ObserveCall("user_service", "PromoteUserToAdmin", time.Now(), &err)
+
+	_, err = primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+	if userID == actor.UserID {
+		return ErrOwnRole
+	}
+
+	err = requireHeld(actor, "role", models.AllPermissions)      // what the admin role grants
+	if err != nil {
+		return err
+	}
 
-	objID, err := primitive.ObjectIDFromHex(userID)
+	user, err := userServ.users.FindByID(ctx, userID)
+	if err == ErrUserNotFound {
+		return err
+	}
 	if err != nil {
-		return errors.New("invalid user ID format")
+		return InternalError(err)
+	}
+	if user.Role == models.RoleAdmin {
+		return nil      // nothing changes, their sessions can stay
 	}
 
     // update user's role to admin
-    result, err := collection.UpdateOne(
-        ctx,
-        bson.M{"_id": objID},
-        bson.M{"$set": bson.M{"role": "admin"}},
-    )
-    
-    if err != nil {
-        log.Printf("Error promoting user: %v", err)
-        return errors.New("failed to promote user")
+    err = userServ.users.SetRole(ctx, userID, models.RoleAdmin)
+    if err == ErrUserNotFound {
+        return err
     }
-    
-    if result.MatchedCount == 0 {
-        return errors.New("user not found")
+    if err != nil {
+        return InternalError(fmt.Errorf("failed to promote user %s: %w", userID, err))
     }
-    
-    return nil     // success
-}
 
-// temporary secret
-var jwtSecret = []byte("jwt-auth-secret")
+	// tokens name the role they were issued with, new ones carry the admin role
+	return userServ.RevokeAllSessions(ctx, userID)
+}
 
-func GenerateToken(userID, username, role string) (string, error){
-	// create token with claims 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": userID,            // user id          
-		"username": username,        // username
-		"role": role,                // user role (admin/user)
-		"exp": time.Now().Add(time.Hour * 24).Unix(),      // expires in 24h
-	})
+// random url-safe token for use as an opaque refresh token
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
 
-	// sign with secret key
-	return token.SignedString(jwtSecret)
+// refresh tokens are looked up by hash, so a leaked database doesn't leak usable tokens
+func hashToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
 }
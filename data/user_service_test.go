@@ -0,0 +1,190 @@
+package data
+
+// imports
+import (
+	"context";
+	"errors";
+	"io";
+	"log/slog";
+	"testing";
+	"time";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/auth";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+// user, role and session services on in-memory storage, sharing one user repository like in main.go
+type testServices struct {
+	users        *InMemoryUserRepository
+	roles        *InMemoryRoleStore
+	revocations  *InMemoryRevocationStore
+	userService  *UserService
+	roleService  *RoleService
+}
+
+func newTestServices(t *testing.T) *testServices {
+	t.Helper()
+
+	jwtConfig := config.JWTConfig{
+		Secret:          "0123456789abcdef0123456789abcdef",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+		Issuer:          "task-manager-api",
+		Audience:        "task-manager-api",
+		ClockSkew:       30 * time.Second,
+	}
+	keys, err := auth.LoadKeySet(jwtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := &testServices{
+		users:       NewInMemoryUserRepository(),
+		roles:       NewInMemoryRoleStore(),
+		revocations: NewInMemoryRevocationStore(),
+	}
+	t.Cleanup(func() { services.revocations.Close() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	services.userService = NewUserService(services.users, NewInMemoryRefreshTokenStore(), services.revocations, jwtConfig, keys, logger)
+	services.roleService = NewRoleService(services.roles, services.users, services.userService)
+	return services
+}
+
+// store a user with role directly, skipping registration and its password hashing
+func (services *testServices) addUser(t *testing.T, username, role string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Password: "unused", Role: role}
+	err := services.users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// actor for user as the auth middleware would build it, with the permissions of their role
+func (services *testServices) actor(t *testing.T, user *models.User) models.Actor {
+	t.Helper()
+	permissions, err := services.roleService.Permissions(context.Background(), user.Role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.Actor{UserID: user.ID, Role: user.Role, Permissions: permissions}
+}
+
+func (services *testServices) roleOf(t *testing.T, user *models.User) string {
+	t.Helper()
+	stored, err := services.users.FindByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored.Role
+}
+
+// whether access tokens issued to user a minute ago are rejected now
+func (services *testServices) sessionsRevoked(t *testing.T, user *models.User) bool {
+	t.Helper()
+	revoked, err := services.revocations.IsRevoked(context.Background(), "some-token", user.ID, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return revoked
+}
+
+func TestPromoteUserToAdminGuards(t *testing.T) {
+
+	ctx := context.Background()
+	services := newTestServices(t)
+	admin := services.addUser(t, "admin", models.RoleAdmin)
+	user := services.addUser(t, "user", models.RoleUser)
+
+	// a role that can promote but doesn't hold everything the admin role grants
+	err := services.roles.Insert(ctx, &models.Role{Name: "promoter", Permissions: []string{models.PermTasksRead, models.PermUsersPromote}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	promoter := services.addUser(t, "promoter", "promoter")
+
+	err = services.userService.PromoteUserToAdmin(ctx, services.actor(t, promoter), promoter.ID)
+	if !errors.Is(err, ErrOwnRole) {
+		t.Errorf("promoting yourself: got %v, want %v", err, ErrOwnRole)
+	}
+
+	err = services.userService.PromoteUserToAdmin(ctx, services.actor(t, promoter), user.ID)
+	if !errors.Is(err, ErrForbidden) || errorCode(err) != "permission_not_held" {
+		t.Errorf("promoting without holding every permission: got %v, want permission_not_held", err)
+	}
+	if role := services.roleOf(t, user); role != models.RoleUser {
+		t.Errorf("refused promotion changed the role to %q", role)
+	}
+
+	err = services.userService.PromoteUserToAdmin(ctx, services.actor(t, admin), user.ID)
+	if err != nil {
+		t.Fatalf("admin promoting a user: %v", err)
+	}
+	if role := services.roleOf(t, user); role != models.RoleAdmin {
+		t.Errorf("role after promotion = %q, want %q", role, models.RoleAdmin)
+	}
+	if !services.sessionsRevoked(t, user) {
+		t.Error("tokens issued before the promotion still work")
+	}
+}
+
+// stable code of a service error, "" for anything else
+func errorCode(err error) string {
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		return serviceErr.Code
+	}
+	return ""
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+
+	ctx := context.Background()
+	services := newTestServices(t)
+
+	err := services.userService.Register(ctx, &models.User{Username: "user", Password: "12345678"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := func() *models.TokenPair {
+		tokens, _, err := services.userService.Login(ctx, &models.Credentials{Username: "user", Password: "12345678"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens
+	}
+	first := login()
+	other := login()      // a second login is a family of its own
+
+	second, err := services.userService.RefreshSession(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	third, err := services.userService.RefreshSession(ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatalf("refreshing the rotated token: %v", err)
+	}
+
+	// the first token was rotated already, seeing it again means it leaked
+	_, err = services.userService.RefreshSession(ctx, first.RefreshToken)
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reusing a rotated token: got %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	// every token of the family goes with it, including the newest one the thief or the user may hold
+	_, err = services.userService.RefreshSession(ctx, third.RefreshToken)
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("newest token of the reused family: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	_, err = services.userService.RefreshSession(ctx, second.RefreshToken)
+	if err == nil {
+		t.Error("a used token of the reused family was accepted")
+	}
+
+	_, err = services.userService.RefreshSession(ctx, other.RefreshToken)
+	if err != nil {
+		t.Errorf("token from another login: %v", err)
+	}
+}
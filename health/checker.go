@@ -0,0 +1,96 @@
+package health
+
+// imports
+import (
+	"context";
+	"sync";
+	"time";
+)
+
+// longest a single dependency check may take before it counts as failed
+const checkTimeout = 2 * time.Second
+
+// reports whether one dependency is usable, nil means healthy
+type CheckFunc func(ctx context.Context) error
+
+// outcome of one dependency check
+type CheckResult struct {
+	Status       string      `json:"status"`               // "ok" or "error"
+	LatencyMS    float64     `json:"latency_ms"`           // how long the check took
+	Error        string      `json:"error,omitempty"`      // why the check failed
+}
+
+// outcome of a health or readiness probe
+type Report struct {
+	Status       string                    `json:"status"`              // "ok" or "error"
+	Checks       map[string]CheckResult    `json:"checks,omitempty"`    // per-dependency results, by name
+}
+
+// whether the probe passed
+func (report Report) OK() bool {
+	return report.Status == "ok"
+}
+
+type namedCheck struct {
+	name         string
+	check        CheckFunc
+}
+
+// runs the readiness checks of every dependency the server needs to serve traffic
+type Checker struct {
+	checks       []namedCheck     // registered checks, in registration order
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// add a dependency check, only call this before the server starts
+func (checker *Checker) Register(name string, check CheckFunc) {
+	checker.checks = append(checker.checks, namedCheck{name: name, check: check})
+}
+
+// run every check concurrently, each one bounded by checkTimeout
+func (checker *Checker) Ready(ctx context.Context) Report {
+
+	report := Report{Status: "ok", Checks: make(map[string]CheckResult, len(checker.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, named := range checker.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := run(ctx, named.check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[named.name] = result
+			if result.Status != "ok" {
+				report.Status = "error"
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+func run(ctx context.Context, check CheckFunc) CheckResult {
+
+	contx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(contx)
+	result := CheckResult{
+		Status:    "ok",
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	}
+
+	return result
+}
@@ -0,0 +1,105 @@
+package logging
+
+// imports
+import (
+	"context";
+	"fmt";
+	"io";
+	"log/slog";
+	"sync";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
+	"go.opentelemetry.io/otel/trace";
+)
+
+// per-request values added to every log line written with the request's context
+type Fields struct {
+	mu           sync.RWMutex
+	requestID    string       // X-Request-ID, accepted from the client or generated
+	route        string       // route pattern, e.g. /tasks/:id
+	userID       string       // set once the auth middleware has identified the caller
+}
+
+type fieldsKey struct{}
+
+// attach fresh request fields to ctx
+func NewContext(ctx context.Context, requestID, route string) (context.Context, *Fields) {
+	fields := &Fields{requestID: requestID, route: route}
+	return context.WithValue(ctx, fieldsKey{}, fields), fields
+}
+
+// request fields carried by ctx, nil outside of a request
+func FromContext(ctx context.Context) *Fields {
+	fields, _ := ctx.Value(fieldsKey{}).(*Fields)
+	return fields
+}
+
+// record the authenticated user, lines logged from then on include it
+func (fields *Fields) SetUserID(userID string) {
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	fields.userID = userID
+}
+
+func (fields *Fields) RequestID() string {
+	fields.mu.RLock()
+	defer fields.mu.RUnlock()
+	return fields.requestID
+}
+
+// slog handler adding request fields and the trace id found in the context to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (handler contextHandler) Handle(ctx context.Context, record slog.Record) error {
+
+	fields := FromContext(ctx)
+	if fields != nil {
+		fields.mu.RLock()
+		record.AddAttrs(slog.String("request_id", fields.requestID), slog.String("route", fields.route))
+		if fields.userID != "" {
+			record.AddAttrs(slog.String("user_id", fields.userID))
+		}
+		fields.mu.RUnlock()
+	}
+
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.HasTraceID() {
+		record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()))
+	}
+
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{handler.Handler.WithGroup(name)}
+}
+
+// build the application logger writing to out. use the *Context logging methods
+// (InfoContext, ErrorContext, ...) so lines carry the request they belong to
+func New(out io.Writer, logConfig config.LogConfig) (*slog.Logger, error) {
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(logConfig.Level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q", logConfig.Level)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch logConfig.Format {
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	case "text":
+		handler = slog.NewTextHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", logConfig.Format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
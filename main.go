@@ -2,31 +2,235 @@ package main
 
 // imports
 import (
+	"context";
+	"errors";
 	"fmt";
-	"log";
+	"log/slog";
+	"net/http";
+	"os";
+	"os/signal";
+	"strings";
+	"syscall";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/auth";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/health";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/logging";
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/router";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/tracing";
 )
 
 // entry point of the Enhanced Task Manager REST API application
 func main() {
-	fmt.Println("Enhanced Task Manager REST API Project")      // print startup message
+	// until the configuration is loaded, problems are logged with default settings
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	// load settings from defaults, the optional config file and the environment
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		fatal(logger, "failed to load configuration", err)
+	}
+
+	configured, err := logging.New(os.Stdout, cfg.Log)
+	if err != nil {
+		fatal(logger, "failed to set up logging", err)
+	}
+	logger = configured
+	slog.SetDefault(logger)      // the standard log package and libraries using it end up here too
+
+	// gin's debug output (routes, warnings) as structured debug lines
+	gin.DebugPrintRouteFunc = func(httpMethod, absolutePath, handlerName string, nuHandlers int) {
+		logger.Debug("route registered", "method", httpMethod, "path", absolutePath, "handler", handlerName)
+	}
+	gin.DebugPrintFunc = func(format string, values ...interface{}) {
+		logger.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)))
+	}
+
+	logger.Info("starting Enhanced Task Manager REST API")
+
+	// signing keys shared by token generation and validation
+	keys, err := auth.LoadKeySet(cfg.JWT)
+	if err != nil {
+		fatal(logger, "failed to load signing keys", err)
+	}
+
+	verifier := auth.NewVerifier(keys, cfg.JWT)      // checks issuer, audience and expiry on top of the signature
+
+	// tracing goes first, so the mongodb client picks up the tracer provider
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal(logger, "failed to set up tracing", err)
+	}
+
+	var taskService data.TaskManager
+	var userService *data.UserService
+	var roleService *data.RoleService
+	var revocations data.RevocationStore
+	var closeStorage func(ctx context.Context) error      // releases storage once requests have drained
+
+	// dependencies checked by /readyz
+	checker := health.NewChecker()
+	checker.Register("signing_keys", func(ctx context.Context) error {
+		return keys.Check()
+	})
 
 	// initialize service and controller layers
-	taskService, err := data.NewMongoDBTaskManager (      // create persistent task service instance using mongodb go driver 
-			"mongodb://localhost:27017",
-			"taskdb",
-			"tasks",
-	)        
-	
+	if cfg.Storage.Backend == "memory" {
+		// keep everything in memory, no database required (data is lost on exit)
+		logger.Info("using in-memory storage")
+		memoryRevocations := data.NewInMemoryRevocationStore()
+		memoryUsers := data.NewInMemoryUserRepository()
+
+		taskService = data.NewInMemoryTaskManager(memoryUsers)
+		revocations = memoryRevocations
+		userService = data.NewUserService(memoryUsers, data.NewInMemoryRefreshTokenStore(), revocations, cfg.JWT, keys, logger)
+		roleService = data.NewRoleService(data.NewInMemoryRoleStore(), memoryUsers, userService)
+		closeStorage = func(ctx context.Context) error {
+			return memoryRevocations.Close()
+		}
+	} else {
+		// connecting and creating indexes share one startup deadline
+		startup, cancel := context.WithTimeout(context.Background(), cfg.Mongo.ConnectTimeout)
+		defer cancel()
+
+		mongoTaskService, err := data.NewMongoDBTaskManager (      // create persistent task service instance using mongodb go driver
+				startup,
+				cfg.Mongo.URI,
+				cfg.Mongo.Database,
+				cfg.Mongo.TaskCollection,
+				cfg.Mongo.TaskHistoryCollection,
+				cfg.Mongo.UserCollection,
+				cfg.Mongo.QueryTimeout,
+				logger,
+		)
+
+		if err != nil {
+			fatal(logger, "failed to connect to mongodb", err)
+		}
+		logger.Info("connected to mongodb", "database", cfg.Mongo.Database)
+
+		userRepo, err := data.NewMongoDBUserRepository (      // users live in their own collection on the same connection
+				startup,
+				mongoTaskService.Client(),
+				cfg.Mongo.Database,
+				cfg.Mongo.UserCollection,
+				cfg.Mongo.QueryTimeout,
+		)
+
+		if err != nil {
+			fatal(logger, "failed to set up user repository", err)
+		}
+
+		refreshTokenStore, err := data.NewMongoDBRefreshTokenStore (      // refresh tokens expire through a ttl index
+				startup,
+				mongoTaskService.Client(),
+				cfg.Mongo.Database,
+				cfg.Mongo.RefreshTokenCollection,
+				cfg.Mongo.QueryTimeout,
+		)
+
+		if err != nil {
+			fatal(logger, "failed to set up refresh token store", err)
+		}
+
+		revocationStore, err := data.NewMongoDBRevocationStore (      // revoked tokens expire through a ttl index
+				startup,
+				mongoTaskService.Client(),
+				cfg.Mongo.Database,
+				cfg.Mongo.RevocationCollection,
+				cfg.Mongo.QueryTimeout,
+		)
+
+		if err != nil {
+			fatal(logger, "failed to set up revocation store", err)
+		}
+
+		roleStore := data.NewMongoDBRoleStore(      // custom roles, keyed by name
+				mongoTaskService.Client(),
+				cfg.Mongo.Database,
+				cfg.Mongo.RoleCollection,
+				cfg.Mongo.QueryTimeout,
+		)
+
+		taskService = mongoTaskService
+		revocations = revocationStore
+		userService = data.NewUserService(userRepo, refreshTokenStore, revocations, cfg.JWT, keys, logger)
+		roleService = data.NewRoleService(roleStore, userRepo, userService)
+		closeStorage = mongoTaskService.Close
+
+		checker.Register("mongo", mongoTaskService.Ping)
+		checker.Register("mongo_indexes", func(ctx context.Context) error {
+			return errors.Join(
+				mongoTaskService.CheckIndexes(ctx),
+				userRepo.CheckIndexes(ctx),
+				refreshTokenStore.CheckIndexes(ctx),
+				revocationStore.CheckIndexes(ctx),
+			)
+		})
+	}
+
+	taskService = data.NewInstrumentedTaskManager(taskService)      // latency and error metrics for every task call
+
+	// deleted tasks can be restored until their retention runs out
+	purger := data.NewTaskPurger(taskService, cfg.Storage.TrashRetention, cfg.Storage.PurgeInterval, logger)
+
+	router := router.SetupRouter(taskService, *userService, roleService, revocations, keys, verifier, cfg.Auth, checker, logger)	  // initialize the router with all configured routes
+
+	server := &http.Server{
+		Addr:    cfg.Server.Addr,
+		Handler: router,
+	}
+
+	// cancelled on the first SIGINT/SIGTERM, a second one kills the process right away
+	stop, stopNotify := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopNotify()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("starting server", "addr", cfg.Server.Addr)
+		serverErr <- server.ListenAndServe()                // start the server on the configured address
+	}()
+
+	var serveErr error
+	select {
+	case serveErr = <-serverErr:
+		logger.Error("server stopped", "error", serveErr)              // e.g. address already in use, nothing to drain
+	case <-stop.Done():
+		stopNotify()
+		logger.Info("shutting down, waiting for in-flight requests", "grace_period", cfg.Server.ShutdownTimeout.String())
+	}
+
+	// stop accepting connections and let in-flight requests finish within the grace period
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	err = server.Shutdown(ctx)
+	if err != nil {
+		logger.Error("failed to drain connections", "error", err)
+	}
+
+	// storage goes last, the requests drained above and the purger may still be using it
+	purger.Close()
+	err = closeStorage(ctx)
+	if err != nil {
+		logger.Error("failed to close storage", "error", err)
+	}
+
+	// flush spans still buffered, including the ones from the drained requests
+	err = shutdownTracing(ctx)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("failed to flush traces", "error", err)
+	}
+
+	if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		os.Exit(1)
 	}
-	defer taskService.Close()
+	logger.Info("server stopped")
+}
 
-	userService := data.NewUserService(taskService)   // reuse same DB connection as the task
-	router := router.SetupRouter(taskService, *userService)	  // initialize the router with all configured routes
-	
-	router.Run(":8080")                        // start the server on port 8080
-	log.Println("Starting server on :8080")
-}
\ No newline at end of file
+// log a startup problem and exit, never used once requests are being served
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
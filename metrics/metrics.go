@@ -0,0 +1,79 @@
+package metrics
+
+// imports
+import (
+	"net/http";
+	"time";
+	"github.com/prometheus/client_golang/prometheus";
+	"github.com/prometheus/client_golang/prometheus/collectors";
+	"github.com/prometheus/client_golang/prometheus/promhttp";
+)
+
+// every metric the api exposes, plus go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// http requests by method, route pattern (e.g. /tasks/:id) and status code
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time to handle HTTP requests, by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// login attempts: "success", "failure" (bad credentials) or "error" (storage or token problems)
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts, by result.",
+	}, []string{"result"})
+
+	// access tokens rejected by the auth middleware, by reason
+	TokenValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_token_validation_failures_total",
+		Help: "Access tokens rejected by the auth middleware, by reason.",
+	}, []string{"reason"})
+
+	// TaskManager and UserService calls, by component and method name
+	ServiceCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "service_call_duration_seconds",
+		Help:    "Time spent in task and user service calls, by component and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"component", "method"})
+
+	ServiceCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_call_errors_total",
+		Help: "Task and user service calls that returned an error, by component and method.",
+	}, []string{"component", "method"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		Logins,
+		TokenValidationFailures,
+		ServiceCallDuration,
+		ServiceCallErrors,
+	)
+}
+
+// record the latency and outcome of a service call, meant to be deferred with a named error result:
+//
+//	defer metrics.ObserveCall("task_manager", "CreateTask", time.Now(), &err)
+func ObserveCall(component, method string, start time.Time, err *error) {
+	ServiceCallDuration.WithLabelValues(component, method).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		ServiceCallErrors.WithLabelValues(component, method).Inc()
+	}
+}
+
+// prometheus text exposition of Registry, served at /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -2,71 +2,118 @@ package middleware
 
 // imports
 import (
-	"net/http";                          
-	"github.com/dgrijalva/jwt-go";        
+	"fmt";
 	"github.com/gin-gonic/gin";          
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/auth";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/logging";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/metrics";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/tracing";
+	"go.opentelemetry.io/otel/codes";
 )
 
-// temporary secret
-var jwtSecret = []byte("jwt-auth-secret")
+var (
+	ErrMissingToken  = data.UnauthorizedError("missing_token", "bearer access token required")
+	ErrInvalidToken  = data.UnauthorizedError("invalid_token", "invalid token")
+	ErrRevokedToken  = data.UnauthorizedError("token_revoked", "token has been revoked")
+)
 
-func ValidateToken(token string) (*jwt.Token, error){
-	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)    // check if token uses HMAC signing  
-		if !ok {
-			return nil, jwt.ErrSignatureInvalid      // block invalid signing 
-		}
-		return jwtSecret, nil     // return secret to verify signature
-	})
+// reject the request, Errors renders the response
+func abortWithError(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
 }
 
-func AuthMiddleWare() gin.HandlerFunc {
+func AuthMiddleWare(verifier *auth.Verifier, revocations data.RevocationStore, roles *data.RoleService, authConfig config.AuthConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		tokenStr := c.GetHeader("Authorization")     // get token from authorization header
-		// reject if empty
-		if tokenStr == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
-			c.Abort()
+		// get token from the authorization header, or the query parameter or cookie if enabled
+		tokenStr, err := bearerToken(c, authConfig)
+		if err == ErrMissingToken {
+			metrics.TokenValidationFailures.WithLabelValues("missing").Inc()
+			challenge(c, "", "")
+			abortWithError(c, err)
+			return
+		}
+		if err != nil {
+			metrics.TokenValidationFailures.WithLabelValues("invalid_request").Inc()
+			challenge(c, "invalid_request", err.Error())
+			abortWithError(c, err)
 			return
 		}
 		
-		// validate token structure/signature with error handling 
-		token, err := ValidateToken(tokenStr)     
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-			c.Abort()
+		// span covering signature checks and the revocation and role lookups, so slow auth shows up in traces
+		ctx, span := tracing.Start(c.Request.Context(), "AuthMiddleWare.ValidateToken")
+		defer span.End()      // early rejections, no-op once ended below
+
+		// validate signature, issuer, audience and validity period
+		claims, err := verifier.Verify(tokenStr)
+		if err != nil {
+			reason := auth.FailureReason(err)
+			span.SetStatus(codes.Error, "invalid token")
+			metrics.TokenValidationFailures.WithLabelValues(reason).Inc()
+			challenge(c, "invalid_token", invalidTokenDescription(reason))
+			abortWithError(c, ErrInvalidToken)
+			return
+		}
+
+		principal := newPrincipal(claims)
+
+		// reject tokens revoked through logout or an admin revoking the user's sessions
+		revoked, err := revocations.IsRevoked(ctx, principal.TokenID, principal.UserID, principal.IssuedAt)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "revocation check failed")
+			metrics.TokenValidationFailures.WithLabelValues("revocation_check_failed").Inc()
+			abortWithError(c, data.InternalError(fmt.Errorf("failed to check token revocation: %w", err)))
+			return
+		}
+		if revoked {
+			span.SetStatus(codes.Error, "token revoked")
+			metrics.TokenValidationFailures.WithLabelValues("revoked").Inc()
+			challenge(c, "invalid_token", "the access token has been revoked")
+			abortWithError(c, ErrRevokedToken)
 			return
 		}
 
-		// if token is valid, extract claims and store in request context
-		claims, ok := token.Claims.(jwt.MapClaims)      
-		if ok {
-			c.Set("userID", claims["sub"])             // user id
-			c.Set("username", claims["username"])      // username 
-			c.Set("role", claims["role"])              // user role (admin/user)
+		// the token only names the role, what it allows is looked up so changes to custom roles apply right away
+		principal.Permissions, err = roles.Permissions(ctx, principal.Role)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "role lookup failed")
+			abortWithError(c, err)      // already an internal error
+			return
 		}
 
+		// tag the rest of the request's logs with the caller
+		fields := logging.FromContext(c.Request.Context())
+		if fields != nil {
+			fields.SetUserID(principal.UserID)
+		}
+
+		c.Set(principalKey, principal)      // read back by handlers through CurrentPrincipal
+
+		span.End()     // the handler gets its own spans, keep this one to authentication
 		c.Next()     // proceed to next handler
 	}
 }
 
-func AdminOnly() gin.HandlerFunc {
+// only let callers through whose role grants every one of permissions, goes after AuthMiddleWare
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		
-		role, exists := c.Get("role")          // get role from context 
+		principal, exists := CurrentPrincipal(c)          // set by AuthMiddleWare
 
-		// block if either role doesn't exist in context or role isn't "admin"
-		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "admin access required",
-			})
-			
-			c.Abort()
-			return
+		// block if there is no authenticated caller or their role is missing a permission
+		for _, permission := range permissions {
+			if !exists || !principal.Actor().Can(permission) {
+				challenge(c, "insufficient_scope", "the "+permission+" permission is required")
+				abortWithError(c, data.ForbiddenError("permission_denied", "the "+permission+" permission is required"))
+				return
+			}
 		}
 
-		c.Next()     // allow admin to proceed
+		c.Next()     // allow caller to proceed
 	}
-}
\ No newline at end of file
+}
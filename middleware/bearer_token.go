@@ -0,0 +1,120 @@
+package middleware
+
+// imports
+import (
+	"net/http";
+	"regexp";
+	"strings";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+)
+
+// realm sent in WWW-Authenticate challenges
+const authRealm = "task-manager-api"
+
+var (
+	ErrMalformedAuthorization = data.ValidationError("malformed_authorization", "access token must be sent as the Bearer scheme followed by a token")
+	ErrMultipleTokens         = data.ValidationError("multiple_tokens", "access token sent in more than one place")
+	ErrQueryTokenNotAllowed   = data.ValidationError("query_token_not_allowed", "access token in the query string is only accepted on GET requests")
+)
+
+// b64token from RFC 6750 section 2.1
+var bearerTokenPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
+// find the request's access token: the Authorization header (RFC 6750 section 2.1), then the query
+// parameter and the cookie if they are enabled. the header and query parameter are explicit, so a
+// request using both is refused; the cookie is sent by browsers on every request and only used alone
+func bearerToken(c *gin.Context, authConfig config.AuthConfig) (string, error) {
+
+	headerToken, err := authorizationToken(c.GetHeader("Authorization"))
+	if err != nil {
+		return "", err
+	}
+
+	var queryToken string
+	if authConfig.QueryParam != "" {
+		queryToken = c.Query(authConfig.QueryParam)
+		if queryToken != "" {
+			// keep the token out of anything that reads the query later on
+			query := c.Request.URL.Query()
+			query.Del(authConfig.QueryParam)
+			c.Request.URL.RawQuery = query.Encode()
+		}
+	}
+
+	switch {
+	case headerToken != "" && queryToken != "":
+		return "", ErrMultipleTokens
+	case headerToken != "":
+		return headerToken, nil
+	case queryToken != "":
+		if c.Request.Method != http.MethodGet {
+			return "", ErrQueryTokenNotAllowed      // SSE and WebSocket handshakes are GETs, nothing else needs it
+		}
+		if !bearerTokenPattern.MatchString(queryToken) {
+			return "", ErrMalformedAuthorization
+		}
+		return queryToken, nil
+	}
+
+	if authConfig.CookieName != "" {
+		cookie, err := c.Cookie(authConfig.CookieName)
+		if err == nil && cookie != "" {
+			if !bearerTokenPattern.MatchString(cookie) {
+				return "", ErrMalformedAuthorization
+			}
+			return cookie, nil
+		}
+	}
+
+	return "", ErrMissingToken
+}
+
+// token from an Authorization header, empty if there is none or it uses another scheme
+func authorizationToken(header string) (string, error) {
+
+	if header == "" {
+		return "", nil
+	}
+
+	scheme, token, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", nil      // e.g. Basic, which we don't support, counts as no credentials
+	}
+
+	token = strings.TrimLeft(token, " ")
+	if !bearerTokenPattern.MatchString(token) {
+		return "", ErrMalformedAuthorization
+	}
+	return token, nil
+}
+
+// set the WWW-Authenticate challenge (RFC 6750 section 3) for a request the auth middleware rejects.
+// errorCode is empty when the request had no credentials at all
+func challenge(c *gin.Context, errorCode, description string) {
+	value := `Bearer realm="` + authRealm + `"`
+	if errorCode != "" {
+		value += `, error="` + errorCode + `", error_description="` + description + `"`
+	}
+	c.Header("WWW-Authenticate", value)
+}
+
+// error_description for a token the verifier rejected, by failure reason
+func invalidTokenDescription(reason string) string {
+	switch reason {
+	case "expired":
+		return "the access token expired"
+	case "not_yet_valid":
+		return "the access token is not valid yet"
+	case "wrong_issuer", "wrong_audience":
+		return "the access token was not issued for this service"
+	case "unknown_key", "invalid_signature":
+		return "the access token signature is invalid"
+	case "missing_claims":
+		return "the access token is missing required claims"
+	case "malformed":
+		return "the access token is malformed"
+	}
+	return "the access token is invalid"
+}
@@ -0,0 +1,95 @@
+package middleware
+
+// imports
+import (
+	"encoding/json";
+	"errors";
+	"log/slog";
+	"net/http";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/logging";
+)
+
+// error response body (RFC 7807 problem details) with a stable code clients can branch on
+type Problem struct {
+	Type       string              `json:"type"`                    // always "about:blank", the code says what went wrong
+	Title      string              `json:"title"`                   // http status text
+	Status     int                 `json:"status"`                  // http status code
+	Detail     string              `json:"detail,omitempty"`        // human readable explanation
+	Instance   string              `json:"instance,omitempty"`      // path of the failed request
+	Code       string              `json:"code"`                    // stable error code, e.g. "task_not_found"
+	RequestID  string              `json:"request_id,omitempty"`    // same as the X-Request-ID header, for support requests
+	Errors     []data.FieldError   `json:"errors,omitempty"`        // per field details for validation errors
+}
+
+// http status for each kind of data.Error
+func problemStatus(err *data.Error) int {
+	switch {
+	case errors.Is(err.Kind, data.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err.Kind, data.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err.Kind, data.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err.Kind, data.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err.Kind, data.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err.Kind, data.ErrPrecondition):
+		return http.StatusPreconditionFailed
+	case errors.Is(err.Kind, data.ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusInternalServerError
+}
+
+// render the last error a handler or middleware added with c.Error as application/problem+json.
+// errors that aren't a *data.Error are treated as internal: logged, but never shown to the caller
+func Errors(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		c.Next()     // let the handlers run first
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+
+		var appErr *data.Error
+		if !errors.As(err, &appErr) {
+			appErr = data.InternalError(err)
+		}
+		if problemStatus(appErr) == http.StatusInternalServerError {
+			logger.ErrorContext(c.Request.Context(), "request failed", slog.String("code", appErr.Code), slog.String("error", err.Error()))
+		}
+
+		writeProblem(c, err, appErr)
+	}
+}
+
+// write err as a problem response, appErr is the *data.Error found in it
+func writeProblem(c *gin.Context, err error, appErr *data.Error) {
+
+	status := problemStatus(appErr)
+	detail := appErr.Message
+	if status != http.StatusInternalServerError {
+		detail = err.Error()      // may carry context added while wrapping, e.g. "invalid task query: invalid cursor"
+	}
+
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+		Code:     appErr.Code,
+		Errors:   appErr.Fields,
+	}
+	if fields := logging.FromContext(c.Request.Context()); fields != nil {
+		problem.RequestID = fields.RequestID()
+	}
+
+	body, _ := json.Marshal(problem)      // plain strings and ints, can't fail
+	c.Data(status, "application/problem+json", body)
+}
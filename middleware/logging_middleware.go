@@ -0,0 +1,53 @@
+package middleware
+
+// imports
+import (
+	"fmt";
+	"io";
+	"log/slog";
+	"net/http";
+	"runtime/debug";
+	"time";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data";
+)
+
+// one structured line per request, in place of gin's text logger.
+// probes and scrapes are only logged at debug level, they would drown out real traffic
+func AccessLog(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		start := time.Now()
+		c.Next()     // handle the request first
+
+		level := slog.LevelInfo
+		switch {
+		case c.Writer.Status() >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case c.Request.URL.Path == "/healthz" || c.Request.URL.Path == "/readyz" || c.Request.URL.Path == "/metrics":
+			level = slog.LevelDebug
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "request handled",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", c.Writer.Status()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds()) / 1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		)
+	}
+}
+
+// turn a panicking handler into a 500 for that request only, logging the stack trace
+func Recovery(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logger.ErrorContext(c.Request.Context(), "panic while handling request",
+			slog.String("panic", fmt.Sprint(recovered)),
+			slog.String("stack", string(debug.Stack())),
+		)
+		appErr := data.InternalError(fmt.Errorf("panic: %v", recovered))
+		writeProblem(c, appErr, appErr)
+		c.Abort()
+	})
+}
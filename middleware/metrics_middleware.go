@@ -0,0 +1,27 @@
+package middleware
+
+// imports
+import (
+	"strconv";
+	"time";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/metrics";
+)
+
+// count requests and record their latency by route pattern, so /tasks/:id is one series and not one per task
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		start := time.Now()
+		c.Next()     // handle the request first
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"      // 404s, kept in one series so random paths can't blow up cardinality
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
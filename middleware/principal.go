@@ -0,0 +1,49 @@
+package middleware
+
+// imports
+import (
+	"time";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/auth";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models";
+)
+
+// gin context key AuthMiddleWare stores the principal under
+const principalKey = "principal"
+
+// the authenticated caller of a request, taken from its verified access token
+type Principal struct {
+	UserID       string         // id of the authenticated user ("sub")
+	Username     string         // username
+	Role         string         // user role (admin, user or a custom role)
+	Permissions  []string       // permissions of the role, looked up on every request so role changes apply right away
+	TokenID      string         // token id ("jti"), used to revoke the token on logout
+	IssuedAt     time.Time      // issue time, checked against user-wide revocations
+	ExpiresAt    time.Time      // token expiry, revocation entry can be dropped after it
+}
+
+func newPrincipal(claims *auth.Claims) Principal {
+	return Principal{
+		UserID:    claims.Subject,
+		Username:  claims.Username,
+		Role:      claims.Role,
+		TokenID:   claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,      // both required by the verifier
+	}
+}
+
+// the principal as the data layer sees it
+func (principal Principal) Actor() models.Actor {
+	return models.Actor{UserID: principal.UserID, Role: principal.Role, Permissions: principal.Permissions}
+}
+
+// the caller AuthMiddleWare authenticated, false on routes it doesn't guard
+func CurrentPrincipal(c *gin.Context) (Principal, bool) {
+	value, exists := c.Get(principalKey)
+	if !exists {
+		return Principal{}, false
+	}
+	principal, ok := value.(Principal)
+	return principal, ok
+}
@@ -0,0 +1,49 @@
+package middleware
+
+// imports
+import (
+	"crypto/rand";
+	"encoding/hex";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/logging";
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// client-supplied ids are reused only if they are short and plain, so they can't inject into logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		isPlain := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' || r == ':'
+		if !isPlain {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// accept or generate an X-Request-ID, echo it in the response and tag the request's logs with it
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Header(requestIDHeader, requestID)      // set before the handler writes the response
+
+		ctx, _ := logging.NewContext(c.Request.Context(), requestID, c.FullPath())
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()     // proceed to next handler
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+// authenticated user performing an operation (taken from the jwt claims)
+type Actor struct {
+	UserID       string      // id of the authenticated user
+	Role         string      // user role (admin, user or a custom role)
+	Permissions  []string    // permissions of the role when the request came in
+}
+
+// whether the actor holds permission, holding its ":any" form counts too
+func (actor Actor) Can(permission string) bool {
+	for _, granted := range actor.Permissions {
+		if granted == permission || granted == permission+":any" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package models
+
+// built-in roles, always present and never stored
+const (
+	RoleAdmin  = "admin"      // every permission
+	RoleUser   = "user"       // manages the tasks they own, the default for new users
+)
+
+// permissions a role can grant. a permission ending in ":any" covers every task, the one without it only
+// tasks the user created (or, for reading, is assigned to), and holding the ":any" one grants both
+const (
+	PermTasksRead           = "tasks:read"                  // list, search and view tasks and their history
+	PermTasksReadAny        = "tasks:read:any"
+	PermTasksCreate         = "tasks:create"                // create tasks
+	PermTasksUpdate         = "tasks:update"                // replace, patch and restore earlier revisions of tasks
+	PermTasksUpdateAny      = "tasks:update:any"
+	PermTasksDelete         = "tasks:delete"                // move tasks to the trash, see the trash and restore from it
+	PermTasksDeleteAny      = "tasks:delete:any"
+	PermUsersPromote        = "users:promote"               // promote users to admin and assign them roles
+	PermUsersRevokeSessions = "users:revoke_sessions"       // revoke every session of a user
+	PermRolesManage         = "roles:manage"                // create, change and delete custom roles
+)
+
+// every permission a role can grant
+var AllPermissions = []string{
+	PermTasksRead, PermTasksReadAny,
+	PermTasksCreate,
+	PermTasksUpdate, PermTasksUpdateAny,
+	PermTasksDelete, PermTasksDeleteAny,
+	PermUsersPromote,
+	PermUsersRevokeSessions,
+	PermRolesManage,
+}
+
+// named set of permissions users are assigned, custom roles are stored in their own collection
+type Role struct {
+	Name         string      `bson:"_id" json:"name"`                                     // unique role name, lowercase
+	Description  string      `bson:"description" json:"description"`                      // what the role is for (optional field)
+	Permissions  []string    `bson:"permissions" json:"permissions"`                      // permissions granted to users with the role
+	BuiltIn      bool        `bson:"-" json:"built_in"`                                   // admin and user, which can't be changed or deleted
+}
+
+type RoleAssignment struct {
+	Role         string      `json:"role" binding:"required"`        // name of the role to give the user (required field)
+}
@@ -13,4 +13,9 @@ type Task struct {
 	Description     string                `bson:"description" json:"description"`    			            // description of task
 	DueDate         time.Time             `bson:"due_date" json:"due_date"`  		                              // due date of task (ISO 8601 format)
 	Status          string                `bson:"status" json:"status" binding:"oneof=pending in_progress completed"`       // status of task
+	CreatedBy       string                `bson:"created_by" json:"created_by"`                                    // id of the user who created the task
+	AssignedTo      string                `bson:"assigned_to" json:"assigned_to"`                                  // id of the user the task is assigned to
+	Version         int64                 `bson:"version" json:"version"`                                          // bumped on every change, sent as the ETag (set by the server)
+	DeletedAt       *time.Time            `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`                // when the task was moved to the trash, nil while it is live
+	DeletedBy       string                `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`                // id of the user who moved it to the trash
 }
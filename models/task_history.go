@@ -0,0 +1,36 @@
+package models
+
+// imports
+import (
+	"time";
+	"go.mongodb.org/mongo-driver/bson/primitive";
+)
+
+// what happened to a task in one history entry
+const (
+	TaskCreated   = "created"
+	TaskUpdated   = "updated"
+	TaskRestored  = "restored"      // set back to an earlier revision
+	TaskDeleted   = "deleted"       // moved to the trash
+	TaskUndeleted = "undeleted"     // taken back out of the trash
+)
+
+// one field that changed, From is null for new tasks
+type FieldChange struct {
+	Field           string                `bson:"field" json:"field"`                                  // json name of the field
+	From            any                   `bson:"from" json:"from"`                                    // value before the change
+	To              any                   `bson:"to" json:"to"`                                        // value after the change
+}
+
+// immutable record of one change to a task, appended on every create, update and delete and removed when the task is purged
+type TaskRevision struct {
+	ID              primitive.ObjectID    `bson:"_id,omitempty" json:"-"`                              // unique identifier of the entry generated by mongodb
+	TaskID          primitive.ObjectID    `bson:"task_id" json:"task_id"`                              // task the entry belongs to
+	Revision        int64                 `bson:"revision" json:"revision"`                            // task version the change produced
+	Action          string                `bson:"action" json:"action"`                                // created, updated, restored, deleted or undeleted
+	ActorID         string                `bson:"actor_id" json:"actor_id"`                            // id of the user who made the change
+	At              time.Time             `bson:"at" json:"at"`                                        // when the change was made
+	RestoredFrom    int64                 `bson:"restored_from,omitempty" json:"restored_from,omitempty"`      // revision a restore went back to
+	Changes         []FieldChange         `bson:"changes" json:"changes"`                              // fields that changed
+	Task            Task                  `bson:"task" json:"task"`                                    // the whole task after the change
+}
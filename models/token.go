@@ -0,0 +1,32 @@
+package models
+
+// imports
+import (
+	"time";
+)
+
+// server-side record of an opaque refresh token (the raw token is never stored)
+type RefreshToken struct {
+	ID           string      `bson:"_id" json:"-"`                   // sha-256 hash of the raw token
+	UserID       string      `bson:"user_id" json:"-"`               // owner of the token
+	FamilyID     string      `bson:"family_id" json:"-"`             // shared by every token rotated from the same login
+	ExpiresAt    time.Time   `bson:"expires_at" json:"-"`            // token can't be used after this time
+	CreatedAt    time.Time   `bson:"created_at" json:"-"`            // when the token was issued
+	Used         bool        `bson:"used" json:"-"`                  // already exchanged for a new token
+	Revoked      bool        `bson:"revoked" json:"-"`               // family was revoked (e.g. token reuse detected)
+}
+
+// tokens handed to the client after login or refresh
+type TokenPair struct {
+	AccessToken      string      `json:"token"`              // short-lived jwt access token
+	RefreshToken     string      `json:"refresh_token"`      // long-lived opaque refresh token
+	ExpiresIn        int64       `json:"expires_in"`         // access token lifetime in seconds
+}
+
+type RefreshRequest struct {
+	RefreshToken     string      `json:"refresh_token" binding:"required"`     // refresh token from login or the previous refresh (required field)
+}
+
+type LogoutRequest struct {
+	RefreshToken     string      `json:"refresh_token"`      // refresh token to revoke along with the access token (optional field)
+}
@@ -7,6 +7,12 @@ type User struct {
 	Role         string      `bson:"role" json:"role"`                // user role (role/user)
 }
 
+// what a client may send to /register, everything else about a user is decided by the server
+type Registration struct {
+	Username     string      `json:"username"`        // requested username
+	Password     string      `json:"password"`        // plain password, hashed before storage
+}
+
 type Credentials struct {
 	Username 	 string          `json:"username" binding:"required"`     // login username (required field)
         Password 	 string 	 `json:"password" binding:"required"`     // login password (required field)
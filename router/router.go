@@ -2,43 +2,93 @@ package router
 
 //imports
 import (
+	"log/slog"
 	"github.com/gin-gonic/gin"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/auth"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config"
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/controllers"
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/health"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/metrics"
 	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/middleware"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/tracing"
 )
 
-func SetupRouter(taskService data.TaskManager, userService data.UserService) *gin.Engine {
-	router := gin.Default()     // create default gin router
+func SetupRouter(taskService data.TaskManager, userService data.UserService, roleService *data.RoleService, revocations data.RevocationStore, keys *auth.KeySet, verifier *auth.Verifier, authConfig config.AuthConfig, checker *health.Checker, logger *slog.Logger) *gin.Engine {
+	router := gin.New()     // create gin router, logging and recovery are set up below
+	router.Use(middleware.RequestID())          // accept or generate X-Request-ID and tag logs with it
+	router.Use(middleware.Recovery(logger))     // a panicking handler fails its own request, not the server
+	router.Use(tracing.Middleware())      // server span per request, continues incoming trace context
+	router.Use(middleware.AccessLog(logger))    // one structured log line per request
+	router.Use(middleware.Metrics())      // request counts and latency for every route
+	router.Use(middleware.Errors(logger))       // render errors from handlers as problem+json, innermost so logs and metrics see the final status
 
 	taskController := controllers.NewTaskController(taskService)      // inject task service into task controller
-	userConroller := controllers.NewUserController(userService)       // inject user service into user controller
+	userConroller := controllers.NewUserController(userService, authConfig)       // inject user service and cookie settings into user controller
+	roleController := controllers.NewRoleController(roleService)      // inject role service into role controller
+	keyController := controllers.NewKeyController(keys)               // inject signing keys into key controller
+	healthController := controllers.NewHealthController(checker)      // inject dependency checks into health controller
 
 	// authenticated routes 
-	authMiddleWare := middleware.AuthMiddleWare()
+	authMiddleWare := middleware.AuthMiddleWare(verifier, revocations, roleService, authConfig)
 	
+	// what each route needs is checked against the caller's role, the service layer
+	// additionally limits callers without the ":any" permission to their own tasks
+	readTasks := middleware.RequirePermission(models.PermTasksRead)
+	createTasks := middleware.RequirePermission(models.PermTasksCreate)
+	updateTasks := middleware.RequirePermission(models.PermTasksUpdate)
+	deleteTasks := middleware.RequirePermission(models.PermTasksDelete)
+
 	authGroup := router.Group("/")
 	authGroup.Use(authMiddleWare)
 	{
-		authGroup.GET("/tasks", taskController.GetAllTasks)          // get all tasks
-		authGroup.GET("/tasks/:id", taskController.GetTaskByID)      // get specific task by id
+		authGroup.GET("/tasks", readTasks, taskController.GetAllTasks)          // get all tasks
+		authGroup.GET("/tasks/search", readTasks, taskController.SearchTasks)   // full-text search over tasks
+		authGroup.GET("/tasks/trash", deleteTasks, taskController.GetDeletedTasks)      // deleted tasks the caller can restore
+		authGroup.GET("/tasks/:id", readTasks, taskController.GetTaskByID)      // get specific task by id
+		authGroup.GET("/tasks/:id/history", readTasks, taskController.GetTaskHistory)      // every recorded change of a task
+		authGroup.POST("/tasks/:id/history/:rev/restore", updateTasks, taskController.RestoreTaskRevision)      // set task back to an earlier revision (owner or tasks:update:any, checked in service layer)
+		authGroup.POST("/tasks/:id/restore", deleteTasks, taskController.RestoreDeletedTask)      // take task out of the trash (owner or tasks:delete:any, checked in service layer)
+		authGroup.POST("/tasks", createTasks, taskController.CreateTask)          // create new task owned by the caller
+		authGroup.DELETE("/tasks/:id", deleteTasks, taskController.DeleteTask)    // move task to the trash (owner or tasks:delete:any, checked in service layer)
+		authGroup.PUT("/tasks/:id", updateTasks, taskController.UpdateTask)       // replace existing task (owner or tasks:update:any, checked in service layer)
+		authGroup.PATCH("/tasks/:id", updateTasks, taskController.PatchTask)      // merge patch or json patch existing task (owner or tasks:update:any, checked in service layer)
+		authGroup.POST("/logout", userConroller.Logout)              // revoke the caller's token
 	}
 
-	// admin only routes 
-	adminOnly := middleware.AdminOnly()
+	// user and role administration
+	promoteUsers := middleware.RequirePermission(models.PermUsersPromote)
+	revokeSessions := middleware.RequirePermission(models.PermUsersRevokeSessions)
+	manageRoles := middleware.RequirePermission(models.PermRolesManage)
 
 	adminGroup := router.Group("/")
-	adminGroup.Use(authMiddleWare, adminOnly)
+	adminGroup.Use(authMiddleWare)
 	{
-		adminGroup.POST("/tasks", taskController.CreateTask)            // create new task
-		adminGroup.DELETE("/tasks/:id", taskController.DeleteTask)      // delete task by id
-		adminGroup.PUT("/tasks/:id", taskController.UpdateTask)         // update existing task
-		adminGroup.PUT("/promote/:id", userConroller.PromoteAdmin)      // promote user to admin
+		adminGroup.PUT("/promote/:id", promoteUsers, userConroller.PromoteAdmin)      // promote user to admin
+		adminGroup.PUT("/users/:id/role", promoteUsers, roleController.AssignRole)      // give user a built-in or custom role
+		adminGroup.DELETE("/users/:id/sessions", revokeSessions, userConroller.RevokeSessions)      // revoke all sessions for user
+		adminGroup.GET("/permissions", manageRoles, roleController.GetPermissions)      // every permission a role can grant
+		adminGroup.GET("/roles", manageRoles, roleController.GetRoles)            // built-in and custom roles
+		adminGroup.POST("/roles", manageRoles, roleController.CreateRole)         // create custom role
+		adminGroup.GET("/roles/:name", manageRoles, roleController.GetRole)       // get specific role by name
+		adminGroup.PUT("/roles/:name", manageRoles, roleController.UpdateRole)    // replace description and permissions of a custom role
+		adminGroup.DELETE("/roles/:name", manageRoles, roleController.DeleteRole)      // delete custom role no user has
 	}
 	
 	// public routes
+	router.GET("/healthz", healthController.Liveness)           // process is alive
+	router.GET("/readyz", healthController.Readiness)           // dependencies are usable, route traffic here
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))        // prometheus scrape endpoint
+	router.GET("/.well-known/jwks.json", keyController.JWKS)     // public keys for verifying our tokens
 	router.POST("/register", userConroller.Register)        // register new user
 	router.POST("/login", userConroller.Login)              // authenticate a user
+	router.POST("/token/refresh", userConroller.RefreshToken)   // exchange a refresh token for new tokens
+
+	// unknown paths get the same error format as everything else
+	router.NoRoute(func(c *gin.Context) {
+		c.Error(data.NotFoundError("route_not_found", "no route matches "+c.Request.Method+" "+c.Request.URL.Path))
+	})
 
 	return router     // return configured router
 } 
\ No newline at end of file
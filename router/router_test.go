@@ -0,0 +1,424 @@
+package router
+
+//imports
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"github.com/gin-gonic/gin"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/auth"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/data"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/health"
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/models"
+)
+
+// the whole api on in-memory storage, wired like main.go does for STORAGE_BACKEND=memory
+type testApp struct {
+	engine  *gin.Engine
+	tasks   *data.InMemoryTaskManager      // for what has no endpoint, like purging the trash
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	jwtConfig := config.JWTConfig{
+		Secret:          "0123456789abcdef0123456789abcdef",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+		Issuer:          "task-manager-api",
+		Audience:        "task-manager-api",
+		ClockSkew:       30 * time.Second,
+	}
+	keys, err := auth.LoadKeySet(jwtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	revocations := data.NewInMemoryRevocationStore()
+	t.Cleanup(func() { revocations.Close() })
+	users := data.NewInMemoryUserRepository()
+	tasks := data.NewInMemoryTaskManager(users)
+	userService := data.NewUserService(users, data.NewInMemoryRefreshTokenStore(), revocations, jwtConfig, keys, logger)
+	roleService := data.NewRoleService(data.NewInMemoryRoleStore(), users, userService)
+
+	engine := SetupRouter(data.NewInstrumentedTaskManager(tasks), *userService, roleService, revocations, keys, auth.NewVerifier(keys, jwtConfig), config.AuthConfig{}, health.NewChecker(), logger)
+	return &testApp{engine: engine, tasks: tasks}
+}
+
+// send a request with an optional bearer token and json body, headers come as name, value pairs
+func (app *testApp) do(t *testing.T, method, path, token, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	request := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+
+	recorder := httptest.NewRecorder()
+	app.engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// register username and return an access token for them, the first user registered is the admin
+func (app *testApp) login(t *testing.T, username string) string {
+	t.Helper()
+
+	credentials := fmt.Sprintf(`{"username":%q,"password":"12345678"}`, username)
+	response := app.do(t, http.MethodPost, "/register", "", credentials)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("register %s: %d %s", username, response.Code, response.Body)
+	}
+
+	var tokens struct {
+		Token string `json:"token"`
+	}
+	decode(t, expect(t, app.do(t, http.MethodPost, "/login", "", credentials), http.StatusOK), &tokens)
+	return tokens.Token
+}
+
+func (app *testApp) createTask(t *testing.T, token, title string, due time.Time) models.Task {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"title":%q,"description":"some details","due_date":%q,"status":"pending"}`, title, due.Format(time.RFC3339))
+	var task models.Task
+	decode(t, expect(t, app.do(t, http.MethodPost, "/tasks", token, body), http.StatusCreated), &task)
+	return task
+}
+
+// fail unless the response has status, returns it for chaining
+func expect(t *testing.T, response *httptest.ResponseRecorder, status int) *httptest.ResponseRecorder {
+	t.Helper()
+	if response.Code != status {
+		t.Fatalf("status = %d, want %d: %s", response.Code, status, response.Body)
+	}
+	return response
+}
+
+// fail unless the response is an error with status and code
+func expectError(t *testing.T, response *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var problem struct {
+		Code string `json:"code"`
+	}
+	decode(t, expect(t, response, status), &problem)
+	if problem.Code != code {
+		t.Fatalf("error code = %q, want %q: %s", problem.Code, code, response.Body)
+	}
+}
+
+func decode(t *testing.T, response *httptest.ResponseRecorder, value any) {
+	t.Helper()
+	err := json.Unmarshal(response.Body.Bytes(), value)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", response.Body, err)
+	}
+}
+
+func TestTaskCursorPagination(t *testing.T) {
+
+	app := newTestApp(t)
+	token := app.login(t, "alice")
+
+	due := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	var want []string
+	for i := 0; i < 5; i++ {
+		task := app.createTask(t, token, fmt.Sprintf("task %d", i), due.AddDate(0, 0, 4-i))      // created in reverse due order
+		want = append([]string{task.ID.Hex()}, want...)
+	}
+
+	// walk every page, each one starting where the previous cursor points
+	var got []string
+	var firstCursor string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination doesn't end")
+		}
+		var page data.TaskPage
+		decode(t, expect(t, app.do(t, http.MethodGet, "/tasks?limit=2&sort=due_date&cursor="+cursor, token, ""), http.StatusOK), &page)
+		if page.Total != 5 {
+			t.Errorf("total = %d, want 5", page.Total)
+		}
+		for _, task := range page.Tasks {
+			got = append(got, task.ID.Hex())
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if firstCursor == "" {
+			firstCursor = page.NextCursor
+		}
+		cursor = page.NextCursor
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("tasks across pages = %v, want %v", got, want)
+	}
+
+	// a cursor only works for the order it was created with
+	expectError(t, app.do(t, http.MethodGet, "/tasks?limit=2&sort=due_date&order=desc&cursor="+firstCursor, token, ""), http.StatusBadRequest, "invalid_task_query")
+	expectError(t, app.do(t, http.MethodGet, "/tasks?limit=2&sort=title&cursor="+firstCursor, token, ""), http.StatusBadRequest, "invalid_task_query")
+
+	// tampered cursors are rejected instead of starting somewhere arbitrary
+	raw, err := base64.RawURLEncoding.DecodeString(firstCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := map[string]map[string]any{
+		"id": {"id": "not-an-object-id"},
+		"value": {"v": "yesterday"},
+	}
+	for name, changes := range tampered {
+		changed := map[string]any{}
+		for key, value := range fields {
+			changed[key] = value
+		}
+		for key, value := range changes {
+			changed[key] = value
+		}
+		encoded, err := json.Marshal(changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(name, func(t *testing.T) {
+			expectError(t, app.do(t, http.MethodGet, "/tasks?limit=2&sort=due_date&cursor="+base64.RawURLEncoding.EncodeToString(encoded), token, ""), http.StatusBadRequest, "invalid_task_query")
+		})
+	}
+	expectError(t, app.do(t, http.MethodGet, "/tasks?limit=2&sort=due_date&cursor=not*base64!", token, ""), http.StatusBadRequest, "invalid_task_query")
+	expectError(t, app.do(t, http.MethodGet, "/tasks?limit=2&sort=due_date&cursor="+base64.RawURLEncoding.EncodeToString([]byte("not json")), token, ""), http.StatusBadRequest, "invalid_task_query")
+}
+
+func TestPatchTask(t *testing.T) {
+
+	app := newTestApp(t)
+	token := app.login(t, "alice")
+	task := app.createTask(t, token, "write report", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	path := "/tasks/" + task.ID.Hex()
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		return app.do(t, http.MethodPatch, path, token, body, "Content-Type", contentType)
+	}
+	current := func() models.Task {
+		var task models.Task
+		decode(t, expect(t, app.do(t, http.MethodGet, path, token, ""), http.StatusOK), &task)
+		return task
+	}
+
+	// merge patch changes what it names and leaves the rest, null clears a field
+	expect(t, patch(data.MergePatchType, `{"title":"write the report","description":null}`), http.StatusOK)
+	got := current()
+	if got.Title != "write the report" || got.Description != "" || got.Status != "pending" || got.Version != 2 {
+		t.Errorf("after merge patch: %+v", got)
+	}
+
+	expect(t, patch(data.JSONPatchType, `[{"op":"test","path":"/status","value":"pending"},{"op":"replace","path":"/status","value":"in_progress"}]`), http.StatusOK)
+	if got := current(); got.Status != "in_progress" || got.Version != 3 {
+		t.Errorf("after json patch: %+v", got)
+	}
+
+	// nothing below may change the task
+	invalid := []struct {
+		name, contentType, body, code string
+		status int
+	}{
+		{"failed test", data.JSONPatchType, `[{"op":"test","path":"/status","value":"pending"},{"op":"replace","path":"/title","value":"x"}]`, "patch_test_failed", http.StatusBadRequest},
+		{"unknown op", data.JSONPatchType, `[{"op":"explode","path":"/title"}]`, "invalid_patch", http.StatusBadRequest},
+		{"missing path", data.JSONPatchType, `[{"op":"remove","path":"/nothing/here"}]`, "invalid_patch", http.StatusBadRequest},
+		{"not a list", data.JSONPatchType, `{"op":"replace","path":"/title","value":"x"}`, "invalid_patch", http.StatusBadRequest},
+		{"server field", data.JSONPatchType, `[{"op":"add","path":"/version","value":7}]`, "invalid_patch", http.StatusBadRequest},
+		{"server field by merge", data.MergePatchType, `{"created_by":"someone"}`, "invalid_patch", http.StatusBadRequest},
+		{"invalid result", data.MergePatchType, `{"status":"done"}`, "invalid_task", http.StatusBadRequest},
+		{"cleared required field", data.MergePatchType, `{"title":null}`, "invalid_task", http.StatusBadRequest},
+		{"plain json", "application/json", `{"title":"x"}`, "unsupported_patch_type", http.StatusUnsupportedMediaType},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			expectError(t, patch(test.contentType, test.body), test.status, test.code)
+		})
+	}
+	if got := current(); got.Title != "write the report" || got.Status != "in_progress" || got.Version != 3 {
+		t.Errorf("rejected patches changed the task: %+v", got)
+	}
+}
+
+func TestTaskETags(t *testing.T) {
+
+	app := newTestApp(t)
+	token := app.login(t, "alice")
+	task := app.createTask(t, token, "write report", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	path := "/tasks/" + task.ID.Hex()
+	body := `{"title":"write the report","due_date":"2030-01-02T00:00:00Z","status":"pending"}`
+
+	response := expect(t, app.do(t, http.MethodGet, path, token, ""), http.StatusOK)
+	etag := response.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("ETag = %s, want \"1\"", etag)
+	}
+	expect(t, app.do(t, http.MethodGet, path, token, "", "If-None-Match", etag), http.StatusNotModified)
+	expect(t, app.do(t, http.MethodGet, path, token, "", "If-None-Match", `"7", W/`+etag), http.StatusNotModified)
+	expect(t, app.do(t, http.MethodGet, path, token, "", "If-None-Match", `"7"`), http.StatusOK)
+
+	response = expect(t, app.do(t, http.MethodPut, path, token, body, "If-Match", etag), http.StatusOK)
+	if got := response.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("ETag after update = %s, want \"2\"", got)
+	}
+
+	// the etag read before the update is stale now
+	expectError(t, app.do(t, http.MethodPut, path, token, body, "If-Match", etag), http.StatusPreconditionFailed, "task_version_mismatch")
+	expectError(t, app.do(t, http.MethodDelete, path, token, "", "If-Match", etag), http.StatusPreconditionFailed, "task_version_mismatch")
+	expectError(t, app.do(t, http.MethodPut, path, token, body, "If-Match", `W/"2"`), http.StatusPreconditionFailed, "task_version_mismatch")
+	expectError(t, app.do(t, http.MethodPut, path, token, body, "If-Match", `"1", *`), http.StatusBadRequest, "invalid_if_match")
+
+	// a list matches if any of its tags is the current one
+	expect(t, app.do(t, http.MethodPut, path, token, body, "If-Match", `"1", "2"`), http.StatusOK)
+	expect(t, app.do(t, http.MethodPut, path, token, body, "If-Match", "*"), http.StatusOK)
+	expect(t, app.do(t, http.MethodPut, path, token, body), http.StatusOK)
+	expect(t, app.do(t, http.MethodGet, path, token, "", "If-None-Match", `"5"`), http.StatusNotModified)
+}
+
+func TestTaskHistoryAndRestore(t *testing.T) {
+
+	app := newTestApp(t)
+	token := app.login(t, "alice")
+	other := app.login(t, "bob")
+	task := app.createTask(t, token, "first title", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	path := "/tasks/" + task.ID.Hex()
+
+	expect(t, app.do(t, http.MethodPatch, path, token, `{"title":"second title"}`, "Content-Type", data.MergePatchType), http.StatusOK)
+	expect(t, app.do(t, http.MethodPatch, path, token, `{"status":"completed"}`, "Content-Type", data.MergePatchType), http.StatusOK)
+
+	var history struct {
+		History []models.TaskRevision `json:"history"`
+	}
+	decode(t, expect(t, app.do(t, http.MethodGet, path+"/history", token, ""), http.StatusOK), &history)
+	if len(history.History) != 3 {
+		t.Fatalf("history has %d entries, want 3", len(history.History))
+	}
+	for i, action := range []string{models.TaskCreated, models.TaskUpdated, models.TaskUpdated} {
+		entry := history.History[i]
+		if entry.Action != action || entry.Revision != int64(i+1) {
+			t.Errorf("entry %d = %s at revision %d, want %s at %d", i, entry.Action, entry.Revision, action, i+1)
+		}
+	}
+	if changes := history.History[1].Changes; len(changes) != 1 || changes[0].Field != "title" || changes[0].From != "first title" || changes[0].To != "second title" {
+		t.Errorf("changes of the first update = %+v", changes)
+	}
+
+	// history is as private as the task itself
+	expectError(t, app.do(t, http.MethodGet, path+"/history", other, ""), http.StatusNotFound, "task_not_found")
+	expectError(t, app.do(t, http.MethodPost, path+"/history/1/restore", other, ""), http.StatusNotFound, "task_not_found")
+
+	expectError(t, app.do(t, http.MethodPost, path+"/history/99/restore", token, ""), http.StatusNotFound, "task_revision_not_found")
+	expectError(t, app.do(t, http.MethodPost, path+"/history/1/restore", token, "", "If-Match", `"1"`), http.StatusPreconditionFailed, "task_version_mismatch")
+
+	// restoring is a change of its own, earlier entries stay
+	expect(t, app.do(t, http.MethodPost, path+"/history/1/restore", token, "", "If-Match", `"3"`), http.StatusOK)
+	var restored models.Task
+	decode(t, expect(t, app.do(t, http.MethodGet, path, token, ""), http.StatusOK), &restored)
+	if restored.Title != "first title" || restored.Status != "pending" || restored.Version != 4 {
+		t.Errorf("after restoring revision 1: %+v", restored)
+	}
+
+	decode(t, expect(t, app.do(t, http.MethodGet, path+"/history", token, ""), http.StatusOK), &history)
+	last := history.History[len(history.History)-1]
+	if len(history.History) != 4 || last.Action != models.TaskRestored || last.RestoredFrom != 1 || last.Revision != 4 {
+		t.Errorf("history after restore: %d entries, last %+v", len(history.History), last)
+	}
+}
+
+func TestTrashLifecycle(t *testing.T) {
+
+	app := newTestApp(t)
+	admin := app.login(t, "admin")      // first user, holds tasks:delete:any
+	token := app.login(t, "alice")
+	other := app.login(t, "bob")
+	task := app.createTask(t, token, "write report", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	path := "/tasks/" + task.ID.Hex()
+
+	trash := func(token string) []models.Task {
+		var response struct {
+			Tasks []models.Task `json:"tasks"`
+		}
+		decode(t, expect(t, app.do(t, http.MethodGet, "/tasks/trash", token, ""), http.StatusOK), &response)
+		return response.Tasks
+	}
+
+	expectError(t, app.do(t, http.MethodDelete, path, other, ""), http.StatusNotFound, "task_not_found")
+	expect(t, app.do(t, http.MethodDelete, path, token, ""), http.StatusOK)
+
+	// gone from everything but the trash
+	expectError(t, app.do(t, http.MethodGet, path, token, ""), http.StatusNotFound, "task_not_found")
+	var page data.TaskPage
+	decode(t, expect(t, app.do(t, http.MethodGet, "/tasks", token, ""), http.StatusOK), &page)
+	if page.Total != 0 {
+		t.Errorf("deleted task still listed: %+v", page.Tasks)
+	}
+	deleted := trash(token)
+	if len(deleted) != 1 || deleted[0].ID != task.ID || deleted[0].DeletedAt == nil || deleted[0].DeletedBy == "" {
+		t.Fatalf("trash = %+v, want the deleted task", deleted)
+	}
+	if len(trash(other)) != 0 {
+		t.Error("another user sees the task in their trash")
+	}
+	if len(trash(admin)) != 1 {
+		t.Error("admin doesn't see the task in the trash")
+	}
+
+	expectError(t, app.do(t, http.MethodPost, path+"/restore", other, ""), http.StatusNotFound, "task_not_found")
+	expect(t, app.do(t, http.MethodPost, path+"/restore", token, "", "If-Match", fmt.Sprintf(`"%d"`, deleted[0].Version)), http.StatusOK)
+	var restored models.Task
+	decode(t, expect(t, app.do(t, http.MethodGet, path, token, ""), http.StatusOK), &restored)
+	if restored.DeletedAt != nil || restored.DeletedBy != "" || restored.Title != "write report" {
+		t.Errorf("restored task: %+v", restored)
+	}
+
+	// a new task can't be created straight into the trash
+	forged := `{"title":"forged","due_date":"2030-01-01T00:00:00Z","status":"pending","deleted_at":"2020-01-01T00:00:00Z","deleted_by":"someone"}`
+	var created models.Task
+	decode(t, expect(t, app.do(t, http.MethodPost, "/tasks", token, forged), http.StatusCreated), &created)
+	if created.DeletedAt != nil || created.DeletedBy != "" {
+		t.Errorf("created task is in the trash: %+v", created)
+	}
+
+	// purging only removes tasks past the retention, and those for good
+	expect(t, app.do(t, http.MethodDelete, path, admin, ""), http.StatusOK)
+	purged, err := app.tasks.PurgeDeletedTasks(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil || purged != 0 {
+		t.Fatalf("purging before the retention ran out: %d, %v", purged, err)
+	}
+	purged, err = app.tasks.PurgeDeletedTasks(context.Background(), time.Now().Add(time.Second))
+	if err != nil || purged != 1 {
+		t.Fatalf("purging after the retention ran out: %d, %v", purged, err)
+	}
+	if len(trash(token)) != 0 {
+		t.Error("purged task still in the trash")
+	}
+	expectError(t, app.do(t, http.MethodPost, path+"/restore", token, ""), http.StatusNotFound, "task_not_found")
+	expectError(t, app.do(t, http.MethodGet, path+"/history", admin, ""), http.StatusNotFound, "task_not_found")
+	expect(t, app.do(t, http.MethodGet, "/tasks/"+created.ID.Hex(), token, ""), http.StatusOK)
+}
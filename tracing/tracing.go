@@ -0,0 +1,102 @@
+package tracing
+
+// imports
+import (
+	"context";
+	"fmt";
+	"net/http";
+	"os";
+	"github.com/gin-gonic/gin";
+	"github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth/config";
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin";
+	"go.opentelemetry.io/otel";
+	"go.opentelemetry.io/otel/codes";
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp";
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace";
+	"go.opentelemetry.io/otel/propagation";
+	"go.opentelemetry.io/otel/sdk/resource";
+	sdktrace "go.opentelemetry.io/otel/sdk/trace";
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0";
+	"go.opentelemetry.io/otel/trace";
+)
+
+// instrumentation name for spans created by this application
+const tracerName = "github.com/natnael-eyuel-dev/Task-Management-API-with-JWT-Auth"
+
+// server name recorded on request spans, set by Setup
+var serviceName = "task-manager-api"
+
+// install the global tracer provider described by the tracing configuration.
+// the returned function flushes buffered spans and must be called before exiting.
+// with the "none" exporter nothing is installed and spans cost next to nothing
+func Setup(ctx context.Context, tracingConfig config.TracingConfig) (func(ctx context.Context) error, error) {
+
+	// accept trace context from callers and pass it on, even when not exporting ourselves
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	serviceName = tracingConfig.ServiceName
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch tracingConfig.Exporter {
+	case "none":
+		return func(ctx context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if tracingConfig.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(tracingConfig.Endpoint))      // otherwise OTEL_EXPORTER_OTLP_* or localhost:4318
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", tracingConfig.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %v", tracingConfig.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(tracingConfig.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// gin middleware starting a server span per request, named after the route pattern.
+// probes and scrapes are left out, they would drown out real traffic
+func Middleware() gin.HandlerFunc {
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		switch r.URL.Path {
+		case "/healthz", "/readyz", "/metrics":
+			return false
+		}
+		return true
+	}))
+}
+
+// start a child span of whatever span ctx carries
+func Start(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name)
+}
+
+// end a span, marking it failed if the call returned an error. meant to be deferred with a named error result:
+//
+//	ctx, span := tracing.Start(ctx, "TaskManager.CreateTask")
+//	defer tracing.End(span, &err)
+func End(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}